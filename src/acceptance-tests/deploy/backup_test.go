@@ -82,8 +82,8 @@ var _ = Describe("Backup and restore a deployment", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		AssertBackupRestoreSuccessful := func() func() {
-			return func() {
+		AssertBackupRestoreSuccessful := func() func(SpecContext) {
+			return func(ctx SpecContext) {
 				var err error
 				var cmd *exec.Cmd
 				By("Running pre-backup-checks")
@@ -92,9 +92,9 @@ var _ = Describe("Backup and restore a deployment", func() {
 				Expect(err).NotTo(HaveOccurred(), "stderr was: '%v', stdout was: '%v'", stderr, stdout)
 
 				By("Changing content")
-				err = db.CreateAndPopulateTablesWithPrefix(pgprops.Databases.Databases[0].Name, helpers.Test1Load, "restore")
+				err = db.CreateAndPopulateTablesWithPrefixContext(ctx, pgprops.Databases.Databases[0].Name, helpers.Test1Load, "restore")
 				Expect(err).NotTo(HaveOccurred())
-				result, err := db.CheckTableExist("restore_0", pgprops.Databases.Databases[0].Name)
+				result, err := db.CheckTableExistContext(ctx, "restore_0", pgprops.Databases.Databases[0].Name)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(result).To(BeTrue())
 
@@ -108,7 +108,7 @@ var _ = Describe("Backup and restore a deployment", func() {
 				Expect(files).NotTo(BeEmpty())
 
 				By("Dropping the table")
-				err = db.DropTable(pgprops.Databases.Databases[0].Name, "restore_0")
+				err = db.DropTableContext(ctx, pgprops.Databases.Databases[0].Name, "restore_0")
 				Expect(err).NotTo(HaveOccurred())
 
 				By("Restoring the database")
@@ -117,12 +117,17 @@ var _ = Describe("Backup and restore a deployment", func() {
 				Expect(err).NotTo(HaveOccurred())
 
 				By("Validating that the dropped table has been restored")
-				result, err = db.CheckTableExist("restore_0", pgprops.Databases.Databases[0].Name)
+				result, err = db.CheckTableExistContext(ctx, "restore_0", pgprops.Databases.Databases[0].Name)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(result).To(BeTrue())
 
+				By("Verifying the integrity of the restored tables and indexes")
+				integrity, err := db.CheckIntegrityContext(ctx, pgprops.Databases.Databases[0].Name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(integrity.Corrupted()).To(BeEmpty(), integrity.String())
+
 				By("Dropping the table")
-				err = db.DropTable(pgprops.Databases.Databases[0].Name, "restore_0")
+				err = db.DropTableContext(ctx, pgprops.Databases.Databases[0].Name, "restore_0")
 				Expect(err).NotTo(HaveOccurred())
 			}
 		}
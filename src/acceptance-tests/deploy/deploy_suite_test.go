@@ -20,7 +20,7 @@ func TestDeploy(t *testing.T) {
 	RunSpecs(t, "deploy")
 }
 
-var _ = BeforeSuite(func() {
+var _ = BeforeSuite(func(ctx SpecContext) {
 	var err error
 
 	configPath, err := helpers.ConfigPath()
@@ -52,12 +52,17 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	db, err := deployHelper.ConnectToPostgres(pgHost, pgprops)
 	Expect(err).NotTo(HaveOccurred())
-	err = db.CreateAndPopulateTables(pgprops.Databases.Databases[0].Name, helpers.SmallLoad)
+	err = db.CreateAndPopulateTablesContext(ctx, pgprops.Databases.Databases[0].Name, helpers.SmallLoad)
 	Expect(err).NotTo(HaveOccurred())
 })
 
 var _ = AfterSuite(func() {
 	var err error
+	report := helpers.ConnectionsReport()
+	GinkgoWriter.Println(report)
+	helpers.CloseAllConnections()
+
 	err = deployHelper.GetDeployment().DeleteDeployment()
 	Expect(err).NotTo(HaveOccurred())
+	Expect(report.Leaked).To(BeEmpty(), report.String())
 })
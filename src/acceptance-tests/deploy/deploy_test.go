@@ -44,13 +44,14 @@ var _ = Describe("Create a fresh deployment", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("Successfully validates database configuration", func() {
+		It("Successfully validates database configuration", func(ctx SpecContext) {
 			var err error
-			pgData, err := db.GetData()
+			pgData, err := db.GetDataContext(ctx)
 			Expect(err).NotTo(HaveOccurred())
 			validator := helpers.NewValidator(pgprops, pgData, db, latestPostgreSQLVersion)
-			err = validator.ValidateAll()
+			report, err := validator.FullReportContext(ctx)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Err()).NotTo(HaveOccurred())
 		})
 
 		It("Successfully uses vcap local connections", func() {
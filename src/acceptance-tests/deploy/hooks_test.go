@@ -1,7 +1,6 @@
 package deploy_test
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -63,7 +62,7 @@ var _ = Describe("Test hooks", func() {
 			deployHelper.SetOpDefs(helpers.DefineHooks("0", pre_start_value, post_start_value, pre_stop_value, post_stop_value))
 		})
 
-		It("Successfully manage hooks", func() {
+		It("Successfully manage hooks", func(ctx SpecContext) {
 			var err error
 			var bosh_ssh_command string
 			var cmd *exec.Cmd
@@ -75,16 +74,21 @@ var _ = Describe("Test hooks", func() {
 			Expect(err).NotTo(HaveOccurred(), "stderr was: '%v', stdout was: '%v'", stderr, stdout)
 
 			By("Testing the post-start hook")
-			role_exist, err := db.CheckRoleExist(post_start_role_name)
+			role_exist, err := db.CheckRoleExistContext(ctx, post_start_role_name)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(role_exist).To(BeTrue())
 
 			By("Restarting postgres node")
+			timesBefore, err := db.GetServerTimesContext(ctx)
+			Expect(err).NotTo(HaveOccurred())
 			err = deployHelper.GetDeployment().Restart("postgres")
 			Expect(err).NotTo(HaveOccurred())
+			timesAfter, err := db.GetServerTimesContext(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(timesAfter.ChangeSince(timesBefore)).To(Equal(helpers.ServerRestarted))
 
 			By("Testing the pre-stop hook")
-			role_exist, err = db.CheckRoleExist(pre_stop_role_name)
+			role_exist, err = db.CheckRoleExistContext(ctx, pre_stop_role_name)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(role_exist).To(BeTrue())
 
@@ -105,7 +109,7 @@ var _ = Describe("Test hooks", func() {
 			deployHelper.SetOpDefs(helpers.DefineHooks("3", fmt.Sprintf("for i in $(seq 10); do echo %s-$i; sleep 1; done", pre_start_uuid), "", "", ""))
 		})
 
-		It("Successfully starts postgres", func() {
+		It("Successfully starts postgres", func(ctx SpecContext) {
 			var err error
 			var bosh_ssh_command string
 			var cmd *exec.Cmd
@@ -114,7 +118,7 @@ var _ = Describe("Test hooks", func() {
 			cmd = exec.Command("ssh", "-i", sshKeyFile, "-o", "BatchMode=yes", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no", fmt.Sprintf("%s@%s", deployHelper.GetVariable("testuser_name"), pgHost), fmt.Sprintf(bosh_ssh_command, pre_start_uuid))
 			stdout, stderr, err := helpers.RunCommand(cmd)
 			Expect(err).NotTo(HaveOccurred(), "stderr was: '%v', stdout was: '%v'", stderr, stdout)
-			_, err = db.GetPostgreSQLVersion()
+			_, err = db.GetPostgreSQLVersionContext(ctx)
 			Expect(err).NotTo(HaveOccurred())
 		})
 	})
@@ -135,18 +139,13 @@ EOF
 			deployHelper.SetOpDefs(jan.GetOpDefinitions())
 		})
 
-		It("Runs the script with the expected frequency", func() {
-			conn, err := db.GetSuperUserConnection()
+		It("Runs the script with the expected frequency", func(ctx SpecContext) {
+			conn, err := db.GetSuperUserConnectionContext(ctx)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() int {
-				rows, err := conn.Run("select total from test_hook where name = 'test'")
-				var counter struct {
-					Total int `json:"total"`
-				}
-				Expect(err).NotTo(HaveOccurred())
-				err = json.Unmarshal([]byte(rows[0]), &counter)
+				total, err := helpers.QueryRow[int](ctx, conn, "select total from test_hook where name = $1", "test")
 				Expect(err).NotTo(HaveOccurred())
-				return counter.Total
+				return total
 			}, "15s", "2s").Should(BeNumerically(">", 10))
 		})
 	})
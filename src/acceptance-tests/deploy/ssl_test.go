@@ -1,23 +1,32 @@
 package deploy_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
 
+var allSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
 var _ = Describe("SSL enabled", func() {
 	var sshKeyFile string
 	var bosh_ssh_command string
 	var pgHost string
 	var db helpers.PGData
+	var pgprops helpers.Properties
 
 	JustBeforeEach(func() {
-		var pgprops helpers.Properties
 		var err error
 
 		err = deployHelper.Deploy()
@@ -40,6 +49,31 @@ var _ = Describe("SSL enabled", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	// psqlSource probes connections from the postgres VM through ssh, over
+	// the Unix socket or to 127.0.0.1 depending on kind.
+	psqlSource := func(kind string) helpers.PGProbeSource {
+		return helpers.CommandSource{
+			Label:      kind,
+			SourceKind: kind,
+			Command: func(ctx context.Context, dbname string, user helpers.User, sslmode string) *exec.Cmd {
+				host := ""
+				if kind == helpers.SourceLoopback {
+					host = "-h 127.0.0.1"
+				}
+				psql := fmt.Sprintf("source /var/vcap/jobs/postgres/bin/pgconfig.sh; PGPASSWORD=%s PGSSLMODE=%s $PACKAGE_DIR/bin/psql -w %s -p %d -U %s %s -c 'select 1'",
+					shellQuote(user.Password), sslmode, host, pgprops.Databases.Port, shellQuote(user.Name), shellQuote(dbname))
+				return exec.CommandContext(ctx, "ssh", "-i", sshKeyFile, "-o", "BatchMode=yes", "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no", fmt.Sprintf("%s@%s", deployHelper.GetVariable("testuser_name"), pgHost), psql)
+			},
+		}
+	}
+
+	assertConnectivity := func(ctx context.Context, probe helpers.PGProbe) {
+		matrix := db.ProbeConnectivity(ctx, probe)
+		GinkgoWriter.Println(matrix)
+		expected := helpers.ExpectedConnectivity(pgprops, probe)
+		Expect(matrix.Mismatches(expected)).To(BeEmpty(), matrix.String())
+	}
+
 	Describe("SSL connection enabled", func() {
 
 		BeforeEach(func() {
@@ -62,7 +96,7 @@ var _ = Describe("SSL enabled", func() {
 			Expect(err).To(HaveOccurred())
 		})
 
-		It("Successfully connect using good certificates", func() {
+		It("Successfully connect using good certificates", func(ctx SpecContext) {
 			var err error
 
 			goodCACerts := deployHelper.GetDeployment().GetVariable("postgres_cert")
@@ -70,20 +104,89 @@ var _ = Describe("SSL enabled", func() {
 
 			err = db.ChangeSSLMode("verify-ca", goodCACerts.(map[interface{}]interface{})["ca"].(string))
 			Expect(err).NotTo(HaveOccurred())
-			_, err = db.GetPostgreSQLVersion()
+			_, err = db.GetPostgreSQLVersionContext(ctx)
 			if err != nil {
 				Expect(err.Error()).NotTo(HaveOccurred())
 			}
 
 			err = db.ChangeSSLMode("verify-full", goodCACerts.(map[interface{}]interface{})["ca"].(string))
 			Expect(err).NotTo(HaveOccurred())
-			_, err = db.GetPostgreSQLVersion()
+			_, err = db.GetPostgreSQLVersionContext(ctx)
 			if err != nil {
 				Expect(err.Error()).NotTo(HaveOccurred())
 			}
 		})
 
-		It("Fails to connect using bad certificates", func() {
+		It("Accepts password roles with every sslmode", func(ctx SpecContext) {
+			goodCACerts := deployHelper.GetDeployment().GetVariable("postgres_cert")
+			for _, mode := range allSSLModes {
+				err := db.ChangeSSLMode(mode, goodCACerts.(map[interface{}]interface{})["ca"].(string))
+				Expect(err).NotTo(HaveOccurred())
+				_, err = db.GetPostgreSQLVersionContext(ctx)
+				Expect(err).NotTo(HaveOccurred(), "sslmode=%s", mode)
+			}
+		})
+
+		It("Accepts direct TLS negotiation on PostgreSQL 17 and later", func(ctx SpecContext) {
+			conn, err := db.GetDefaultConnectionContext(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			version, err := conn.ServerVersion(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			directNegotiation, err := helpers.ParsePGVersion("17")
+			Expect(err).NotTo(HaveOccurred())
+			if version.Compare(directNegotiation) < 0 {
+				Skip("direct TLS negotiation requires PostgreSQL 17")
+			}
+
+			goodCACerts := deployHelper.GetDeployment().GetVariable("postgres_cert")
+			for _, mode := range []string{"require", "verify-ca", "verify-full"} {
+				err = db.ChangeSSLMode(mode, goodCACerts.(map[interface{}]interface{})["ca"].(string))
+				Expect(err).NotTo(HaveOccurred())
+				err = db.ChangeSSLNegotiation("direct")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = db.GetPostgreSQLVersionContext(ctx)
+				Expect(err).NotTo(HaveOccurred(), "sslmode=%s sslnegotiation=direct", mode)
+				err = db.ChangeSSLNegotiation("postgres")
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("Accepts and rejects connections as pg_hba.conf specifies", func(ctx SpecContext) {
+			goodCACerts := deployHelper.GetDeployment().GetVariable("postgres_cert")
+			err := db.ChangeSSLMode("verify-full", goodCACerts.(map[interface{}]interface{})["ca"].(string))
+			Expect(err).NotTo(HaveOccurred())
+			users := []helpers.PGProbeUser{
+				{Name: db.Data.DefUser.Name, Password: db.Data.DefUser.Password},
+				{Name: db.Data.AdminUser.Name, Password: db.Data.AdminUser.Password},
+				{Name: "vcap"},
+			}
+
+			assertConnectivity(ctx, helpers.PGProbe{
+				Users:       users,
+				AuthMethods: []string{helpers.AuthPassword},
+				SSLModes:    allSSLModes,
+				Sources:     []helpers.PGProbeSource{helpers.RemoteSource{}},
+			})
+			assertConnectivity(ctx, helpers.PGProbe{
+				Users:       users,
+				AuthMethods: []string{helpers.AuthPassword},
+				SSLModes:    []string{"disable", "allow", "prefer", "require"},
+				Sources:     []helpers.PGProbeSource{psqlSource(helpers.SourceLocal), psqlSource(helpers.SourceLoopback)},
+			})
+		})
+
+		It("Presents a certificate for the deployment host and DNS name", func(ctx SpecContext) {
+			info, err := db.InspectServerTLSContext(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoWriter.Printf("subject=%s issuer=%s key=%s %s %s\n", info.Subject, info.Issuer, info.KeyType, info.TLSVersion, info.CipherSuite)
+			Expect(info.Subject).To(Equal("CN=" + pgHost))
+			Expect(info.Issuer).To(ContainSubstring("CN=postgres_ca"))
+			Expect(info.SANs()).To(ContainElements(pgHost, deployHelper.GetVariable("postgres_dns")))
+			Expect(info.NotAfter).To(BeTemporally(">", time.Now()))
+			Expect(info.TLSVersion).To(BeElementOf("TLS 1.2", "TLS 1.3"))
+		})
+
+		It("Fails to connect using bad certificates", func(ctx SpecContext) {
 			var err error
 
 			badCAcerts := deployHelper.GetDeployment().GetVariable(deployHelper.GetVariable("certs_bad_ca").(string))
@@ -91,7 +194,7 @@ var _ = Describe("SSL enabled", func() {
 
 			err = db.ChangeSSLMode("verify-full", badCAcerts.(map[interface{}]interface{})["certificate"].(string))
 			Expect(err).NotTo(HaveOccurred())
-			_, err = db.GetPostgreSQLVersion()
+			_, err = db.GetPostgreSQLVersionContext(ctx)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("x509"))
 		})
@@ -137,7 +240,7 @@ var _ = Describe("SSL enabled", func() {
 				}
 			})
 
-			It("Successfully authenticate remote user using good certificate", func() {
+			It("Successfully authenticate remote user using good certificate", func(ctx SpecContext) {
 				var err error
 
 				certs := deployHelper.GetDeployment().GetVariable(deployHelper.GetVariable("certs_matching_certs").(string))
@@ -147,7 +250,7 @@ var _ = Describe("SSL enabled", func() {
 				Expect(err).NotTo(HaveOccurred())
 
 				Eventually(func() string {
-					_, err = db.GetPostgreSQLVersion()
+					_, err = db.GetPostgreSQLVersionContext(ctx)
 					if err != nil {
 						return err.Error()
 					}
@@ -155,26 +258,71 @@ var _ = Describe("SSL enabled", func() {
 				}, "30s", "5s").Should(BeEmpty())
 			})
 
-			It("Fails to authenticate remote user using bad certitifcates", func() {
+			It("Fails to authenticate remote user using bad certitifcates", func(ctx SpecContext) {
 				var err error
 				certs := deployHelper.GetDeployment().GetVariable(deployHelper.GetVariable("certs_wrong_certs").(string))
 				err = db.SetCertUserCertificates(deployHelper.GetVariable("certs_matching_name").(string), certs.(map[interface{}]interface{}))
 				Expect(err).NotTo(HaveOccurred())
 				err = db.UseCertAuthentication(true)
 				Expect(err).NotTo(HaveOccurred())
-				_, err = db.GetPostgreSQLVersion()
+				_, err = db.GetPostgreSQLVersionContext(ctx)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("certificate authentication failed"))
 			})
 
-			It("Successfully authenticates remote user using good certificates with mapped common name", func() {
+			It("Accepts certificate roles only over TLS", func(ctx SpecContext) {
+				var err error
+				certs := deployHelper.GetDeployment().GetVariable(deployHelper.GetVariable("certs_matching_certs").(string))
+				err = db.SetCertUserCertificates(deployHelper.GetVariable("certs_matching_name").(string), certs.(map[interface{}]interface{}))
+				Expect(err).NotTo(HaveOccurred())
+				err = db.UseCertAuthentication(true)
+				Expect(err).NotTo(HaveOccurred())
+
+				goodCACerts := deployHelper.GetDeployment().GetVariable("postgres_cert")
+				for _, mode := range allSSLModes {
+					err = db.ChangeSSLMode(mode, goodCACerts.(map[interface{}]interface{})["ca"].(string))
+					Expect(err).NotTo(HaveOccurred())
+					_, err = db.GetPostgreSQLVersionContext(ctx)
+					if mode == "disable" {
+						// Without TLS only the md5 line of pg_hba.conf matches.
+						Expect(err).To(HaveOccurred(), "sslmode=%s", mode)
+					} else {
+						// allow retries with TLS once the plain attempt is rejected.
+						Expect(err).NotTo(HaveOccurred(), "sslmode=%s", mode)
+					}
+				}
+			})
+
+			It("Accepts certificate roles as pg_hba.conf specifies", func(ctx SpecContext) {
+				var users []helpers.PGProbeUser
+				for _, prefix := range []string{"certs_matching", "certs_mapped"} {
+					certs := deployHelper.GetDeployment().GetVariable(deployHelper.GetVariable(prefix + "_certs").(string))
+					err := db.SetCertUserCertificates(deployHelper.GetVariable(prefix+"_name").(string), certs.(map[interface{}]interface{}))
+					Expect(err).NotTo(HaveOccurred())
+					certUser := db.Data.CertUser
+					// Keep the files around: the next call replaces them.
+					db.Data.CertUser = helpers.User{}
+					DeferCleanup(os.Remove, certUser.Certificate)
+					DeferCleanup(os.Remove, certUser.Key)
+					users = append(users, helpers.PGProbeUser{Name: certUser.Name, Certificate: certUser.Certificate, Key: certUser.Key})
+				}
+
+				assertConnectivity(ctx, helpers.PGProbe{
+					Users:       users,
+					AuthMethods: []string{helpers.AuthPassword, helpers.AuthCert},
+					SSLModes:    allSSLModes,
+					Sources:     []helpers.PGProbeSource{helpers.RemoteSource{}},
+				})
+			})
+
+			It("Successfully authenticates remote user using good certificates with mapped common name", func(ctx SpecContext) {
 				var err error
 				certs := deployHelper.GetDeployment().GetVariable(deployHelper.GetVariable("certs_mapped_certs").(string))
 				err = db.SetCertUserCertificates(deployHelper.GetVariable("certs_mapped_name").(string), certs.(map[interface{}]interface{}))
 				Expect(err).NotTo(HaveOccurred())
 				err = db.UseCertAuthentication(true)
 				Expect(err).NotTo(HaveOccurred())
-				_, err = db.GetPostgreSQLVersion()
+				_, err = db.GetPostgreSQLVersionContext(ctx)
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
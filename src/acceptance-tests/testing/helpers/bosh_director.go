@@ -85,6 +85,7 @@ type OpDefinition patch.OpDefinition
 const MissingDeploymentNameMsg = "Invalid manifest: deployment name not present"
 const VMNotPresentMsg = "No VM exists with name %s"
 const ProcessNotPresentInVmMsg = "Process %s does not exist in vm %s"
+const ReleaseNotPresentMsg = "No release %s is used by deployment %s"
 
 func GenerateEnvName(prefix string) string {
 	return fmt.Sprintf("pgats-%s-%s", prefix, GetUUID())
@@ -428,6 +429,21 @@ func (dd DeploymentData) GetVmIdByAddress(vmaddress string) (string, error) {
 	}
 	return "", errors.New(fmt.Sprintf(VMNotPresentMsg, vmaddress))
 }
+
+// GetReleaseVersion returns the version of release name the director has
+// deployed, such as 44 when the manifest asks for latest.
+func (dd DeploymentData) GetReleaseVersion(name string) (string, error) {
+	releases, err := dd.Deployment.Releases()
+	if err != nil {
+		return "", err
+	}
+	for _, release := range releases {
+		if release.Name() == name {
+			return release.Version().AsString(), nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf(ReleaseNotPresentMsg, name, dd.Deployment.Name()))
+}
 func (dd DeploymentData) UpdateResurrection(enable bool) error {
 	vms, err := dd.Deployment.VMInfos()
 	if err != nil {
@@ -10,6 +10,7 @@ import (
 
 	boshdir "github.com/cloudfoundry/bosh-cli/director"
 	fakedir "github.com/cloudfoundry/bosh-cli/director/directorfakes"
+	semver "github.com/cppforlife/go-semi-semantic/version"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -349,6 +350,29 @@ name: test
 				err = director.GetEnv(envName).Start("postgres")
 				Expect(err).NotTo(HaveOccurred())
 			})
+			It("Fails to read the deployed releases", func() {
+				deploymentFake.ReleasesReturns(nil, errors.New("fake-error"))
+				_, err := director.GetEnv(envName).GetReleaseVersion("postgres")
+				Expect(err).To(Equal(errors.New("fake-error")))
+			})
+			It("Gets the version of a deployed release", func() {
+				bpm := &fakedir.FakeRelease{}
+				bpm.NameReturns("bpm")
+				bpm.VersionReturns(semver.MustNewVersionFromString("1.2.3"))
+				postgres := &fakedir.FakeRelease{}
+				postgres.NameReturns("postgres")
+				postgres.VersionReturns(semver.MustNewVersionFromString("44"))
+				deploymentFake.ReleasesReturns([]boshdir.Release{bpm, postgres}, nil)
+				version, err := director.GetEnv(envName).GetReleaseVersion("postgres")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(version).To(Equal("44"))
+			})
+			It("Fails if the release is not deployed", func() {
+				deploymentFake.NameReturns("test")
+				deploymentFake.ReleasesReturns([]boshdir.Release{}, nil)
+				_, err := director.GetEnv(envName).GetReleaseVersion("postgres")
+				Expect(err).To(MatchError(fmt.Sprintf(helpers.ReleaseNotPresentMsg, "postgres", "test")))
+			})
 			It("Fail to pause resurrection", func() {
 				var err error
 				deploymentFake.EnableResurrectionReturns(errors.New("fake-error"))
@@ -17,6 +17,7 @@ type DeployHelper struct {
 	opDefs       []OpDefinition
 	printDiffs   bool
 	networkName  string
+	driver       string
 }
 
 func NewDeployHelper(params PgatsConfig, prefix string, pgVersion int) (DeployHelper, error) {
@@ -35,6 +36,7 @@ func NewDeployHelper(params PgatsConfig, prefix string, pgVersion int) (DeployHe
 	deployHelper.SetDeploymentName(prefix)
 	deployHelper.SetPGVersion(pgVersion)
 	deployHelper.networkName = params.BoshCC.Networks[0].Name
+	deployHelper.driver = params.Driver
 	deployHelper.InitializeVariables()
 	deployHelper.opDefs = nil
 	deployHelper.printDiffs = false
@@ -230,6 +232,7 @@ func (d DeployHelper) ConnectToPostgres(pgHost string, pgprops Properties) (PGDa
 			Password: d.variables["superuser_password"].(string),
 		},
 		CertUser: User{},
+		Driver:   d.driver,
 	}
 	DB, err := NewPostgres(pgc)
 	if err != nil {
@@ -19,6 +19,8 @@ type PgatsConfig struct {
 	PGReleaseVersion  string          `yaml:"postgres_release_version"`
 	PostgreSQLVersion string          `yaml:"postgresql_version"`
 	VersionsFile      string          `yaml:"versions_file"`
+	SnapshotsDir      string          `yaml:"snapshots_dir"`
+	Driver            string          `yaml:"driver"`
 }
 
 var DefaultPgatsConfig = PgatsConfig{
@@ -27,6 +29,8 @@ var DefaultPgatsConfig = PgatsConfig{
 	PGReleaseVersion:  "latest",
 	PostgreSQLVersion: "current",
 	VersionsFile:      "",
+	SnapshotsDir:      "",
+	Driver:            LibPQDriver,
 }
 
 func LoadConfig(configFilePath string) (PgatsConfig, error) {
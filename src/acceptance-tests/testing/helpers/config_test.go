@@ -44,6 +44,8 @@ var _ = Describe("Configuration", func() {
 postgres_release_version: "some-version"
 postgresql_version: "some-version"
 versions_file: "some-path"
+snapshots_dir: "some-dir"
+driver: pgx
 bosh:
   target: some-target
   use_uaa: true
@@ -73,6 +75,8 @@ cloud_configs:
 						PGReleaseVersion:  "some-version",
 						PostgreSQLVersion: "some-version",
 						VersionsFile:      "some-path",
+						SnapshotsDir:      "some-dir",
+						Driver:            helpers.PGXDriver,
 						Bosh: helpers.BOSHConfig{
 							Target: "some-target",
 							UseUaa: true,
@@ -112,6 +116,8 @@ cloud_configs:
 postgres_release_version: "some-version"
 postgresql_version: "some-version"
 versions_file: "some-path"
+snapshots_dir: "some-dir"
+driver: pgx
 bosh:
   target: some-target
   credentials:
@@ -140,6 +146,8 @@ cloud_configs:
 						PGReleaseVersion:  "some-version",
 						PostgreSQLVersion: "some-version",
 						VersionsFile:      "some-path",
+						SnapshotsDir:      "some-dir",
+						Driver:            helpers.PGXDriver,
 						Bosh: helpers.BOSHConfig{
 							Target: "some-target",
 							Credentials: helpers.BOSHCredentials{
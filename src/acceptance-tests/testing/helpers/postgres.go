@@ -2,20 +2,25 @@ package helpers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/gob"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 const DefaultDB = "postgres"
+const DefaultQueryTimeout = 5 * time.Minute
+
+// NoQueryTimeout lets calls run as long as their context allows.
+const NoQueryTimeout time.Duration = -1
 
 type PGData struct {
-	Data PGCommon
-	DBs  []PGConn
+	Data  PGCommon
+	Conns *PGConnRegistry
 }
 
 type User struct {
@@ -23,6 +28,8 @@ type User struct {
 	Password    string
 	Certificate string
 	Key         string
+	// KeyPassword decrypts Key when it is encrypted.
+	KeyPassword string
 }
 
 type PGCommon struct {
@@ -34,27 +41,63 @@ type PGCommon struct {
 	AdminUser   User
 	CertUser    User
 	UseCert     bool
+	SSLCRL      string
+	// ChannelBinding is the SCRAM channel_binding mode; only pgx
+	// supports it.
+	ChannelBinding string
+	// SSLNegotiation is "postgres" (the default) or "direct" for
+	// PostgreSQL 17 and later.
+	SSLNegotiation     string
+	ConnectTimeout     time.Duration
+	ApplicationName    string
+	TargetSessionAttrs string
+	Options            string
+	// Driver selects the client library, LibPQDriver by default.
+	Driver string
+	// QueryTimeout bounds every single round trip to the server. NewPostgres
+	// turns zero into DefaultQueryTimeout; a negative value, such as
+	// NoQueryTimeout, disables the per-call deadline.
+	QueryTimeout time.Duration
 }
 
 type PGConn struct {
 	TargetDB string
 	User     string
 	password string
+	Timeout  time.Duration
+	Driver   string
 	DB       *sql.DB
+	server   *pgServerInfo
 }
 
 type PGSetting struct {
-	Name    string `json:"name"`
-	Setting string `json:"setting"`
-	VarType string `json:"vartype"`
+	Name     string   `json:"name"`
+	Setting  string   `json:"setting"`
+	Unit     string   `json:"unit"`
+	VarType  string   `json:"vartype"`
+	EnumVals []string `json:"enumvals" yaml:",omitempty"`
+	// Source tells where the current value comes from, such as default or
+	// configuration file, and SourceFile which file set it.
+	Source         string `json:"source" yaml:",omitempty"`
+	SourceFile     string `json:"sourcefile" yaml:",omitempty"`
+	PendingRestart bool   `json:"pending_restart" yaml:",omitempty"`
 }
 type PGDatabase struct {
-	Name   string `json:"datname"`
-	DBExts []PGDatabaseExtensions
-	Tables []PGTable
+	Name           string `json:"datname"`
+	Encoding       string `json:"encoding"`
+	Collate        string `json:"datcollate"`
+	CType          string `json:"datctype"`
+	LocaleProvider string `json:"locale_provider"`
+	DBExts         []PGDatabaseExtensions
+	Tables         []PGTable
 }
 type PGDatabaseExtensions struct {
-	Name string `json:"extname"`
+	Name    string `json:"extname"`
+	Version string `json:"extversion"`
+	Schema  string `json:"schema"`
+	// DefaultVersion is the version ALTER EXTENSION ... UPDATE moves to, as
+	// reported by pg_available_extensions.
+	DefaultVersion string `json:"default_version"`
 }
 type PGTable struct {
 	SchemaName     string `json:"schemaname"`
@@ -62,6 +105,7 @@ type PGTable struct {
 	TableOwner     string `json:"tableowner"`
 	TableColumns   []PGTableColumn
 	TableRowsCount PGCount
+	Checksum       string
 }
 type PGTableColumn struct {
 	ColumnName string `json:"column_name"`
@@ -82,27 +126,36 @@ type PGRole struct {
 	CreateDb    bool   `json:"rolcreatedb"`
 	CanLogin    bool   `json:"rolcanlogin"`
 	Replication bool   `json:"rolreplication"`
+	BypassRLS   bool   `json:"rolbypassrls"`
 	ConnLimit   int    `json:"rolconnlimit"`
 	ValidUntil  string `json:"rolvaliduntil"`
 }
 
+type PGDataOptions struct {
+	// TableChecksums computes a fingerprint of the content of every table.
+	TableChecksums bool
+}
+
 type PGOutputData struct {
 	Roles     map[string]PGRole
 	Databases []PGDatabase
 	Settings  map[string]string
-	Version   PGVersion
+	// SettingDetails holds the pg_settings rows behind Settings.
+	SettingDetails map[string]PGSetting `yaml:",omitempty"`
+	Version        PGVersion
 }
 
 const GetSettingsQuery = "SELECT * FROM pg_settings"
 const ListRolesQuery = "SELECT * from pg_roles"
-const GetRoleQuery = "SELECT * from pg_roles where rolname='%s'"
-const GetTableQuery = "SELECT * from pg_catalog.pg_tables where tablename='%s'"
+const GetRoleQuery = "SELECT * from pg_roles where rolname=$1"
+const GetTableQuery = "SELECT * from pg_catalog.pg_tables where tablename=$1"
 const ListDatabasesQuery = "SELECT datname from pg_database where datistemplate=false"
-const ListDBExtensionsQuery = "SELECT extname from pg_extension"
-const ConvertToDateCommand = "SELECT '%s'::timestamptz"
+const ListDBExtensionsQuery = "SELECT e.extname, e.extversion, n.nspname AS schema, coalesce(a.default_version, '') AS default_version FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace LEFT JOIN pg_available_extensions a ON a.name = e.extname ORDER BY e.extname"
+const ConvertToDateCommand = "SELECT $1::timestamptz"
 const ListTablesQuery = "SELECT * from pg_catalog.pg_tables where schemaname not like 'pg_%' and schemaname != 'information_schema'"
-const ListTableColumnsQuery = "SELECT column_name, data_type, ordinal_position FROM information_schema.columns WHERE table_schema = '%s' AND table_name = '%s' order by ordinal_position asc"
+const ListTableColumnsQuery = "SELECT column_name, data_type, ordinal_position FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 order by ordinal_position asc"
 const CountTableRowsQuery = "SELECT COUNT(*) FROM %s"
+const TableChecksumQuery = "SELECT coalesce(md5(string_agg(md5(t::text), '' ORDER BY md5(t::text))), md5('')) AS checksum FROM %s AS t"
 const GetPostgreSQLVersionQuery = "SELECT version()"
 const QueryResultAsJson = "SELECT row_to_json(t) from (%s) as t;"
 const DropTable = "DROP TABLE %s"
@@ -114,15 +167,56 @@ const MissingDefaultUserErr = "Default user not specified"
 const MissingDefaultPasswordErr = "Default password not specified"
 const NoSuperUserProvidedErr = "No super user provided"
 const IncorrectSSLModeErr = "Incorrect SSL mode specified"
+const IncorrectSSLNegotiationErr = "Incorrect SSL negotiation specified"
+const WeakSSLModeForDirectNegotiationErr = "Direct SSL negotiation requires sslmode require, verify-ca or verify-full"
 const MissingSSLRootCertErr = "SSL Root Certificate missing"
 const MissingCertUserErr = "No user specified to authenticate with certificates"
 const MissingCertCertErr = "No certificate specified for cert user"
 const MissingCertKeyErr = "No private key specified for cert user's certificate"
+const InvalidIdentifierErr = "Identifier %q contains a NUL character"
+const InvalidLiteralErr = "Literal %q contains a NUL character"
 
 func GetFormattedQuery(query string) string {
 	return fmt.Sprintf(QueryResultAsJson, query)
 }
 
+// QuoteIdentifier quotes name so it can be used as a single SQL identifier,
+// whatever case or characters it contains. PostgreSQL identifiers cannot
+// contain NUL, so such a name is refused rather than cut at the NUL into a
+// different identifier.
+func QuoteIdentifier(name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf(InvalidIdentifierErr, name)
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`, nil
+}
+
+// QuoteLiteral quotes value as a SQL string constant, for statements such as
+// CREATE ROLE that take no parameters. Backslashes make it an escape string
+// constant, so that the result does not depend on standard_conforming_strings.
+func QuoteLiteral(value string) (string, error) {
+	if strings.ContainsRune(value, 0) {
+		return "", fmt.Errorf(InvalidLiteralErr, value)
+	}
+	quoted := `'` + strings.Replace(value, `'`, `''`, -1) + `'`
+	if strings.Contains(value, `\`) {
+		quoted = ` E` + strings.Replace(quoted, `\`, `\\`, -1)
+	}
+	return quoted, nil
+}
+
+// QuoteQualifiedName quotes each part of a schema-qualified name.
+func QuoteQualifiedName(parts ...string) (string, error) {
+	quoted := make([]string, len(parts))
+	for idx, part := range parts {
+		var err error
+		if quoted[idx], err = QuoteIdentifier(part); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(quoted, "."), nil
+}
+
 func NewPostgres(props PGCommon) (PGData, error) {
 	var pg PGData
 	if props.SSLMode == "" {
@@ -131,6 +225,12 @@ func NewPostgres(props PGCommon) (PGData, error) {
 	if err := checkSSLMode(props.SSLMode, props.SSLRootCert); err != nil {
 		return PGData{}, err
 	}
+	if err := checkSSLNegotiation(props.SSLNegotiation, props.SSLMode); err != nil {
+		return PGData{}, err
+	}
+	if _, err := GetDriver(props.Driver); err != nil {
+		return PGData{}, err
+	}
 	if props.Address == "" {
 		return PGData{}, errors.New(MissingDBAddressErr)
 	}
@@ -146,13 +246,24 @@ func NewPostgres(props PGCommon) (PGData, error) {
 	if props.DefUser.Password == "" {
 		return PGData{}, errors.New(MissingDefaultPasswordErr)
 	}
+	if props.QueryTimeout == 0 {
+		props.QueryTimeout = DefaultQueryTimeout
+	}
 	pg.Data = props
+	pg.Conns = NewPGConnRegistry()
 	return pg, nil
 }
 
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 func checkSSLMode(sslmode string, sslrootcert string) error {
 	var strong_sslmodes = [...]string{"verify-ca", "verify-full"}
-	var valid_sslmodes = [...]string{"disable", "require", "verify-ca", "verify-full"}
+	var valid_sslmodes = [...]string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
 	for _, valid_mode := range valid_sslmodes {
 		if valid_mode == sslmode {
 			for _, strong_mode := range strong_sslmodes {
@@ -166,6 +277,23 @@ func checkSSLMode(sslmode string, sslrootcert string) error {
 	return errors.New(IncorrectSSLModeErr)
 }
 
+// checkSSLNegotiation validates sslnegotiation against sslmode: with direct
+// negotiation the client starts TLS right away, so it cannot fall back to a
+// plain connection.
+func checkSSLNegotiation(negotiation string, sslmode string) error {
+	switch negotiation {
+	case "", "postgres":
+		return nil
+	case "direct":
+		switch sslmode {
+		case "require", "verify-ca", "verify-full":
+			return nil
+		}
+		return errors.New(WeakSSLModeForDirectNegotiationErr)
+	}
+	return errors.New(IncorrectSSLNegotiationErr)
+}
+
 func (pg PGData) getDefaultUser() User {
 	if pg.Data.UseCert {
 		return pg.Data.CertUser
@@ -230,6 +358,9 @@ func (pg *PGData) ChangeSSLMode(sslmode string, sslrootcert string) error {
 	if err := checkSSLMode(sslmode, sslrootcert); err != nil {
 		return err
 	}
+	if err := checkSSLNegotiation(pg.Data.SSLNegotiation, sslmode); err != nil {
+		return err
+	}
 	if sslrootcert != "" {
 		rootCertpath, err = WriteFile(sslrootcert)
 		if err != nil {
@@ -245,50 +376,82 @@ func (pg *PGData) ChangeSSLMode(sslmode string, sslrootcert string) error {
 	return nil
 }
 
-func (pg PGData) buildConnectionData(dbname string, user User) string {
-	result := fmt.Sprintf("dbname=%s user=%s host=%s port=%d sslmode=%s", dbname, user.Name, pg.Data.Address, pg.Data.Port, pg.Data.SSLMode)
-	if pg.Data.SSLRootCert != "" {
-		result = fmt.Sprintf("%s sslrootcert=%s", result, pg.Data.SSLRootCert)
+// ChangeSSLNegotiation switches between the traditional SSLRequest
+// negotiation ("postgres") and direct TLS ("direct", PostgreSQL 17+).
+func (pg *PGData) ChangeSSLNegotiation(negotiation string) error {
+	if err := checkSSLNegotiation(negotiation, pg.Data.SSLMode); err != nil {
+		return err
+	}
+	pg.Data.SSLNegotiation = negotiation
+	pg.CloseConnections()
+	return nil
+}
+
+// ConnectionParams returns the parameters used to connect to dbname as user.
+func (pg PGData) ConnectionParams(dbname string, user User) PGConnParams {
+	params := PGConnParams{
+		Host:               pg.Data.Address,
+		Port:               pg.Data.Port,
+		DBName:             dbname,
+		User:               user.Name,
+		SSLMode:            pg.Data.SSLMode,
+		SSLNegotiation:     pg.Data.SSLNegotiation,
+		SSLRootCert:        pg.Data.SSLRootCert,
+		SSLCRL:             pg.Data.SSLCRL,
+		ChannelBinding:     pg.Data.ChannelBinding,
+		ConnectTimeout:     pg.Data.ConnectTimeout,
+		ApplicationName:    pg.Data.ApplicationName,
+		TargetSessionAttrs: pg.Data.TargetSessionAttrs,
+		Options:            pg.Data.Options,
 	}
 	if user.Password != "" {
-		result = fmt.Sprintf("%s password=%s", result, user.Password)
+		params.Password = user.Password
 	} else {
-		result = fmt.Sprintf("%s sslcert=%s sslkey=%s", result, user.Certificate, user.Key)
+		params.SSLCert = user.Certificate
+		params.SSLKey = user.Key
+		params.SSLPassword = user.KeyPassword
 	}
-	return result
+	return params
 }
 
 func (pg *PGData) OpenConnection(dbname string, user User) (PGConn, error) {
-	var newConn PGConn
-	var err error
-
-	connectionData := pg.buildConnectionData(dbname, user)
-	newConn.DB, err = sql.Open("postgres", connectionData)
+	return pg.OpenConnectionContext(context.Background(), dbname, user)
+}
+func (pg *PGData) OpenConnectionContext(ctx context.Context, dbname string, user User) (PGConn, error) {
+	driver, err := GetDriver(pg.Data.Driver)
+	if err != nil {
+		return PGConn{}, err
+	}
+	db, err := driver.Open(pg.ConnectionParams(dbname, user))
 	if err != nil {
 		return PGConn{}, err
 	}
-	err = newConn.DB.Ping()
+	pingCtx, cancel := withTimeout(ctx, pg.Data.QueryTimeout)
+	defer cancel()
+	err = db.PingContext(pingCtx)
 	if err != nil {
+		db.Close()
 		return PGConn{}, err
 	}
-	newConn.User = user.Name
-	newConn.password = user.Password
-	newConn.TargetDB = dbname
-	newConn.DB.SetMaxIdleConns(10)
-	pg.DBs = append(pg.DBs, newConn)
-	return newConn, nil
+	db.SetMaxIdleConns(10)
+	return pg.AddConnection(dbname, user, db), nil
 }
 func (pg *PGData) CloseConnections() {
-	for _, conn := range pg.DBs {
-		conn.DB.Close()
+	if pg.Conns != nil {
+		pg.Conns.CloseAll()
 	}
-	pg.DBs = nil
 }
 func (pg *PGData) GetDefaultConnection() (PGConn, error) {
-	return pg.GetDBConnection(DefaultDB)
+	return pg.GetDefaultConnectionContext(context.Background())
+}
+func (pg *PGData) GetDefaultConnectionContext(ctx context.Context) (PGConn, error) {
+	return pg.GetDBConnectionContext(ctx, DefaultDB)
 }
 
 func (pg *PGData) GetDBSuperUserConnection(dbname string) (PGConn, error) {
+	return pg.GetDBSuperUserConnectionContext(context.Background(), dbname)
+}
+func (pg *PGData) GetDBSuperUserConnectionContext(ctx context.Context, dbname string) (PGConn, error) {
 	if pg.Data.AdminUser == (User{}) ||
 		pg.Data.AdminUser.Name == "" ||
 		pg.Data.AdminUser.Password == "" {
@@ -296,7 +459,7 @@ func (pg *PGData) GetDBSuperUserConnection(dbname string) (PGConn, error) {
 	}
 	conn, err := pg.GetDBConnectionForUser(dbname, pg.Data.AdminUser)
 	if err != nil {
-		conn, err = pg.OpenConnection(dbname, pg.Data.AdminUser)
+		conn, err = pg.OpenConnectionContext(ctx, dbname, pg.Data.AdminUser)
 		if err != nil {
 			return PGConn{}, err
 		}
@@ -304,13 +467,19 @@ func (pg *PGData) GetDBSuperUserConnection(dbname string) (PGConn, error) {
 	return conn, nil
 }
 func (pg *PGData) GetSuperUserConnection() (PGConn, error) {
-	return pg.GetDBSuperUserConnection(DefaultDB)
+	return pg.GetSuperUserConnectionContext(context.Background())
+}
+func (pg *PGData) GetSuperUserConnectionContext(ctx context.Context) (PGConn, error) {
+	return pg.GetDBSuperUserConnectionContext(ctx, DefaultDB)
 }
 
 func (pg *PGData) GetDBConnection(dbname string) (PGConn, error) {
+	return pg.GetDBConnectionContext(context.Background(), dbname)
+}
+func (pg *PGData) GetDBConnectionContext(ctx context.Context, dbname string) (PGConn, error) {
 	result, err := pg.GetDBConnectionForUser(dbname, pg.getDefaultUser())
 	if (PGConn{}) == result {
-		result, err = pg.OpenConnection(dbname, pg.getDefaultUser())
+		result, err = pg.OpenConnectionContext(ctx, dbname, pg.getDefaultUser())
 		if err != nil {
 			return PGConn{}, err
 		}
@@ -318,34 +487,31 @@ func (pg *PGData) GetDBConnection(dbname string) (PGConn, error) {
 	return result, nil
 }
 func (pg PGData) GetDBConnectionForUser(dbname string, user User) (PGConn, error) {
-	if len(pg.DBs) == 0 {
+	if pg.Conns == nil {
 		return PGConn{}, errors.New(NoConnectionAvailableErr)
 	}
-	var result PGConn
-	for _, conn := range pg.DBs {
-		if conn.TargetDB == dbname {
-			if user.Name == "" || conn.User == user.Name {
-				result = conn
-				break
-			}
-		}
-	}
-	if (PGConn{}) == result {
+	result, ok := pg.Conns.Get(pg.connKey(dbname, user))
+	if !ok {
 		return PGConn{}, errors.New(NoConnectionAvailableErr)
 	}
 	return result, nil
 }
 
-func (pg PGConn) Run(query string) ([]string, error) {
+func (pg PGConn) Run(query string, args ...interface{}) ([]string, error) {
+	return pg.RunContext(context.Background(), query, args...)
+}
+func (pg PGConn) RunContext(ctx context.Context, query string, args ...interface{}) ([]string, error) {
 	var result []string
-	if rows, err := pg.DB.Query(GetFormattedQuery(query)); err != nil {
+	ctx, cancel := withTimeout(ctx, pg.Timeout)
+	defer cancel()
+	if rows, err := pg.DB.QueryContext(ctx, GetFormattedQuery(query), args...); err != nil {
 		return nil, err
 	} else {
 		defer rows.Close()
 		for rows.Next() {
 			var jsonRow string
 			if err := rows.Scan(&jsonRow); err != nil {
-				break
+				return nil, err
 			}
 			result = append(result, jsonRow)
 		}
@@ -356,20 +522,42 @@ func (pg PGConn) Run(query string) ([]string, error) {
 	return result, nil
 }
 
-func (pg PGConn) Exec(query string) error {
-	if _, err := pg.DB.Exec(query); err != nil {
+func (pg PGConn) Exec(query string, args ...interface{}) error {
+	return pg.ExecContext(context.Background(), query, args...)
+}
+func (pg PGConn) ExecContext(ctx context.Context, query string, args ...interface{}) error {
+	ctx, cancel := withTimeout(ctx, pg.Timeout)
+	defer cancel()
+	if _, err := pg.DB.ExecContext(ctx, query, args...); err != nil {
 		return err
 	}
 	return nil
 }
 
+// DropTable drops tableName as found in the search_path of dbName. Use
+// DropSchemaTable for a table of another schema.
 func (pg PGData) DropTable(dbName string, tableName string) error {
-
-	conn, err := pg.GetDBConnection(dbName)
+	return pg.DropTableContext(context.Background(), dbName, tableName)
+}
+func (pg PGData) DropTableContext(ctx context.Context, dbName string, tableName string) error {
+	return pg.dropTable(ctx, dbName, tableName)
+}
+func (pg PGData) DropSchemaTable(dbName string, schemaName string, tableName string) error {
+	return pg.DropSchemaTableContext(context.Background(), dbName, schemaName, tableName)
+}
+func (pg PGData) DropSchemaTableContext(ctx context.Context, dbName string, schemaName string, tableName string) error {
+	return pg.dropTable(ctx, dbName, schemaName, tableName)
+}
+func (pg PGData) dropTable(ctx context.Context, dbName string, name ...string) error {
+	conn, err := pg.GetDBConnectionContext(ctx, dbName)
 	if err != nil {
 		return err
 	}
-	err = conn.Exec(fmt.Sprintf(DropTable, tableName))
+	table, err := QuoteQualifiedName(name...)
+	if err != nil {
+		return err
+	}
+	err = conn.ExecContext(ctx, fmt.Sprintf(DropTable, table))
 	if err != nil {
 		return err
 	}
@@ -377,54 +565,41 @@ func (pg PGData) DropTable(dbName string, tableName string) error {
 }
 
 func (pg PGData) CreateAndPopulateTables(dbName string, loadType LoadType) error {
-	return pg.CreateAndPopulateTablesWithPrefix(dbName, loadType, "pgats_table")
+	return pg.CreateAndPopulateTablesContext(context.Background(), dbName, loadType)
+}
+func (pg PGData) CreateAndPopulateTablesContext(ctx context.Context, dbName string, loadType LoadType) error {
+	return pg.CreateAndPopulateTablesWithPrefixContext(ctx, dbName, loadType, "pgats_table")
 }
 
 func (pg PGData) CreateAndPopulateTablesWithPrefix(dbName string, loadType LoadType, prefix string) error {
+	return pg.CreateAndPopulateTablesWithPrefixContext(context.Background(), dbName, loadType, prefix)
+}
+func (pg PGData) CreateAndPopulateTablesWithPrefixContext(ctx context.Context, dbName string, loadType LoadType, prefix string) error {
 
-	conn, err := pg.GetDBConnection(dbName)
+	conn, err := pg.GetDBConnectionContext(ctx, dbName)
 	if err != nil {
 		return err
 	}
 	tables := GetSampleLoadWithPrefix(loadType, prefix)
 
 	for _, table := range tables {
-		err = conn.Exec(table.PrepareCreate())
-		if err != nil {
-			return err
-		}
-		err = conn.Exec(table.PrepareCreateIndex())
+		create, err := table.PrepareCreate()
 		if err != nil {
 			return err
 		}
-		txn, err := conn.DB.Begin()
+		err = conn.ExecContext(ctx, create)
 		if err != nil {
 			return err
 		}
-
-		stmt, err := txn.Prepare(table.PrepareStatement())
+		createIndex, err := table.PrepareCreateIndex()
 		if err != nil {
 			return err
 		}
-
-		for i := 0; i < table.NumRows; i++ {
-			_, err = stmt.Exec(table.PrepareRow(i)...)
-			if err != nil {
-				return err
-			}
-		}
-
-		_, err = stmt.Exec()
+		err = conn.ExecContext(ctx, createIndex)
 		if err != nil {
 			return err
 		}
-
-		err = stmt.Close()
-		if err != nil {
-			return err
-		}
-
-		err = txn.Commit()
+		err = conn.copyTable(ctx, table)
 		if err != nil {
 			return err
 		}
@@ -433,67 +608,64 @@ func (pg PGData) CreateAndPopulateTablesWithPrefix(dbName string, loadType LoadT
 	return err
 }
 
-func (pg PGData) ReadAllSettings() (map[string]string, error) {
-	result := make(map[string]string)
-	conn, err := pg.GetDefaultConnection()
+func (pg PGConn) copyTable(ctx context.Context, table PGLoadTable) error {
+	driver, err := GetDriver(pg.Driver)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	rows, err := conn.Run(GetSettingsQuery)
+	ctx, cancel := withTimeout(ctx, pg.Timeout)
+	defer cancel()
+	return driver.CopyIn(ctx, pg.DB, table)
+}
+
+func (pg PGData) ReadAllSettings() (map[string]string, error) {
+	return pg.ReadAllSettingsContext(context.Background())
+}
+func (pg PGData) ReadAllSettingsContext(ctx context.Context) (map[string]string, error) {
+	details, err := pg.ReadSettingDetailsContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	for _, row := range rows {
-		out := PGSetting{}
-		err = json.Unmarshal([]byte(row), &out)
-		if err != nil {
-			return nil, err
-		}
-		result[out.Name] = out.Setting
+	return settingValues(details), nil
+}
+func settingValues(details map[string]PGSetting) map[string]string {
+	result := make(map[string]string)
+	for name, setting := range details {
+		result[name] = setting.Setting
 	}
-	return result, nil
+	return result
 }
 func (pg PGData) GetPostgreSQLVersion() (PGVersion, error) {
-	var result PGVersion
-
-	conn, err := pg.GetDefaultConnection()
-	if err != nil {
-		return PGVersion{}, err
-	}
-	rows, err := conn.Run(GetPostgreSQLVersionQuery)
-	if err != nil {
-		return PGVersion{}, err
-	}
-	err = json.Unmarshal([]byte(rows[0]), &result)
+	return pg.GetPostgreSQLVersionContext(context.Background())
+}
+func (pg PGData) GetPostgreSQLVersionContext(ctx context.Context) (PGVersion, error) {
+	conn, err := pg.GetDefaultConnectionContext(ctx)
 	if err != nil {
 		return PGVersion{}, err
 	}
-	return result, nil
+	return QueryRow[PGVersion](ctx, conn, GetPostgreSQLVersionQuery)
 }
 func (pg PGData) ListDatabases() ([]PGDatabase, error) {
-	var result []PGDatabase
-	conn, err := pg.GetSuperUserConnection()
+	return pg.ListDatabasesContext(context.Background())
+}
+func (pg PGData) ListDatabasesContext(ctx context.Context) ([]PGDatabase, error) {
+	return pg.listDatabases(ctx, PGDataOptions{})
+}
+func (pg PGData) listDatabases(ctx context.Context, opts PGDataOptions) ([]PGDatabase, error) {
+	conn, err := pg.GetSuperUserConnectionContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	rows, err := conn.Run(ListDatabasesQuery)
+	result, err := QueryCatalog[PGDatabase](ctx, conn, DatabaseLocalesFeature)
 	if err != nil {
 		return nil, err
 	}
-	for _, row := range rows {
-		out := PGDatabase{}
-		err = json.Unmarshal([]byte(row), &out)
-		if err != nil {
-			return nil, err
-		}
-		result = append(result, out)
-	}
 	for idx, database := range result {
-		result[idx].DBExts, err = pg.ListDatabaseExtensions(database.Name)
+		result[idx].DBExts, err = pg.ListDatabaseExtensionsContext(ctx, database.Name)
 		if err != nil {
 			return nil, err
 		}
-		result[idx].Tables, err = pg.ListDatabaseTables(database.Name)
+		result[idx].Tables, err = pg.listDatabaseTables(ctx, database.Name, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -501,96 +673,76 @@ func (pg PGData) ListDatabases() ([]PGDatabase, error) {
 	return result, nil
 }
 func (pg PGData) ListDatabaseExtensions(dbName string) ([]PGDatabaseExtensions, error) {
-	conn, err := pg.GetDBSuperUserConnection(dbName)
-	if err != nil {
-		return nil, err
-	}
-	rows, err := conn.Run(ListDBExtensionsQuery)
+	return pg.ListDatabaseExtensionsContext(context.Background(), dbName)
+}
+func (pg PGData) ListDatabaseExtensionsContext(ctx context.Context, dbName string) ([]PGDatabaseExtensions, error) {
+	conn, err := pg.GetDBSuperUserConnectionContext(ctx, dbName)
 	if err != nil {
 		return nil, err
 	}
-	extensionsList := []PGDatabaseExtensions{}
-	for _, row := range rows {
-		out := PGDatabaseExtensions{}
-		err = json.Unmarshal([]byte(row), &out)
-		if err != nil {
-			return nil, err
-		}
-		extensionsList = append(extensionsList, out)
-	}
-	return extensionsList, nil
+	return Query[PGDatabaseExtensions](ctx, conn, ListDBExtensionsQuery)
 }
 func (pg PGData) ListDatabaseTables(dbName string) ([]PGTable, error) {
-	conn, err := pg.GetDBSuperUserConnection(dbName)
+	return pg.ListDatabaseTablesContext(context.Background(), dbName)
+}
+func (pg PGData) ListDatabaseTablesContext(ctx context.Context, dbName string) ([]PGTable, error) {
+	return pg.listDatabaseTables(ctx, dbName, PGDataOptions{})
+}
+func (pg PGData) listDatabaseTables(ctx context.Context, dbName string, opts PGDataOptions) ([]PGTable, error) {
+	conn, err := pg.GetDBSuperUserConnectionContext(ctx, dbName)
 	if err != nil {
 		return nil, err
 	}
-	rows, err := conn.Run(ListTablesQuery)
+	tableList, err := Query[PGTable](ctx, conn, ListTablesQuery)
 	if err != nil {
 		return nil, err
 	}
-	tableList := []PGTable{}
-	for _, row := range rows {
-		tableData := PGTable{}
-		err = json.Unmarshal([]byte(row), &tableData)
+	for idx, tableData := range tableList {
+		tableList[idx].TableColumns, err = Query[PGTableColumn](ctx, conn, ListTableColumnsQuery, tableData.SchemaName, tableData.TableName)
 		if err != nil {
 			return nil, err
 		}
-		tableData.TableColumns = []PGTableColumn{}
-		colRows, err := conn.Run(fmt.Sprintf(ListTableColumnsQuery, tableData.SchemaName, tableData.TableName))
+		table, err := QuoteQualifiedName(tableData.SchemaName, tableData.TableName)
 		if err != nil {
 			return nil, err
 		}
-		for _, colRow := range colRows {
-			colData := PGTableColumn{}
-			err = json.Unmarshal([]byte(colRow), &colData)
-			if err != nil {
-				return nil, err
-			}
-			tableData.TableColumns = append(tableData.TableColumns, colData)
-		}
-		countRows, err := conn.Run(fmt.Sprintf(CountTableRowsQuery, tableData.TableName))
+		tableList[idx].TableRowsCount, err = QueryRow[PGCount](ctx, conn, fmt.Sprintf(CountTableRowsQuery, table))
 		if err != nil {
 			return nil, err
 		}
-		count := PGCount{}
-		err = json.Unmarshal([]byte(countRows[0]), &count)
-		if err != nil {
-			return nil, err
+		if opts.TableChecksums {
+			tableList[idx].Checksum, err = QueryRow[string](ctx, conn, fmt.Sprintf(TableChecksumQuery, table))
+			if err != nil {
+				return nil, err
+			}
 		}
-		tableData.TableRowsCount = count
-
-		tableList = append(tableList, tableData)
 	}
 	return tableList, nil
 }
 func (pg PGData) CheckTableExist(table_name string, dbName string) (bool, error) {
-	conn, err := pg.GetDBSuperUserConnection(dbName)
+	return pg.CheckTableExistContext(context.Background(), table_name, dbName)
+}
+func (pg PGData) CheckTableExistContext(ctx context.Context, table_name string, dbName string) (bool, error) {
+	conn, err := pg.GetDBSuperUserConnectionContext(ctx, dbName)
 	if err != nil {
 		return false, err
 	}
-	rows, err := conn.Run(fmt.Sprintf(GetTableQuery, table_name))
+	rows, err := Query[PGTable](ctx, conn, GetTableQuery, table_name)
 	if err != nil {
 		return false, err
 	}
-	if rows != nil && len(rows) != 0 {
-		return true, nil
-	}
-	return false, nil
+	return len(rows) != 0, nil
 }
 func (pg PGData) ListRoles() (map[string]PGRole, error) {
+	return pg.ListRolesContext(context.Background())
+}
+func (pg PGData) ListRolesContext(ctx context.Context) (map[string]PGRole, error) {
 	result := make(map[string]PGRole)
-	conn, err := pg.GetDefaultConnection()
-	if err != nil {
-		return nil, err
-	}
-	rows, err := conn.Run(ListRolesQuery)
+	conn, err := pg.GetDefaultConnectionContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	for _, row := range rows {
-		out := PGRole{}
-		err = json.Unmarshal([]byte(row), &out)
+	for out, err := range QueryRows[PGRole](ctx, conn, ListRolesQuery) {
 		if err != nil {
 			return nil, err
 		}
@@ -599,58 +751,59 @@ func (pg PGData) ListRoles() (map[string]PGRole, error) {
 	return result, nil
 }
 func (pg PGData) CheckRoleExist(role_name string) (bool, error) {
-	conn, err := pg.GetDefaultConnection()
+	return pg.CheckRoleExistContext(context.Background(), role_name)
+}
+func (pg PGData) CheckRoleExistContext(ctx context.Context, role_name string) (bool, error) {
+	conn, err := pg.GetDefaultConnectionContext(ctx)
 	if err != nil {
 		return false, err
 	}
-	rows, err := conn.Run(fmt.Sprintf(GetRoleQuery, role_name))
+	rows, err := Query[PGRole](ctx, conn, GetRoleQuery, role_name)
 	if err != nil {
 		return false, err
 	}
-	if rows != nil && len(rows) != 0 {
-		return true, nil
-	}
-	return false, nil
+	return len(rows) != 0, nil
 }
 
 func (pg PGData) ConvertToPostgresDate(inputDate string) (string, error) {
-	type ConvertedDate struct {
-		Date string `json:"timestamptz"`
-	}
-	result := ConvertedDate{}
+	return pg.ConvertToPostgresDateContext(context.Background(), inputDate)
+}
+func (pg PGData) ConvertToPostgresDateContext(ctx context.Context, inputDate string) (string, error) {
 	inputDate = strings.TrimLeft(inputDate, "'\"")
 	inputDate = strings.TrimRight(inputDate, "'\"")
-	conn, err := pg.GetDefaultConnection()
+	conn, err := pg.GetDefaultConnectionContext(ctx)
 	if err != nil {
 		return "", err
 	}
-	rows, err := conn.Run(fmt.Sprintf(ConvertToDateCommand, inputDate))
-	if err != nil {
-		return "", err
-	}
-	err = json.Unmarshal([]byte(rows[0]), &result)
-	if err != nil {
-		return "", err
-	}
-	return result.Date, nil
+	return QueryRow[string](ctx, conn, ConvertToDateCommand, inputDate)
 }
 
 func (pg PGData) GetData() (PGOutputData, error) {
+	return pg.GetDataContext(context.Background())
+}
+func (pg PGData) GetDataContext(ctx context.Context) (PGOutputData, error) {
+	return pg.GetDataWithOptionsContext(ctx, PGDataOptions{})
+}
+func (pg PGData) GetDataWithOptions(opts PGDataOptions) (PGOutputData, error) {
+	return pg.GetDataWithOptionsContext(context.Background(), opts)
+}
+func (pg PGData) GetDataWithOptionsContext(ctx context.Context, opts PGDataOptions) (PGOutputData, error) {
 	var result PGOutputData
 	var err error
-	result.Settings, err = pg.ReadAllSettings()
+	result.SettingDetails, err = pg.ReadSettingDetailsContext(ctx)
 	if err != nil {
 		return PGOutputData{}, err
 	}
-	result.Databases, err = pg.ListDatabases()
+	result.Settings = settingValues(result.SettingDetails)
+	result.Databases, err = pg.listDatabases(ctx, opts)
 	if err != nil {
 		return PGOutputData{}, err
 	}
-	result.Roles, err = pg.ListRoles()
+	result.Roles, err = pg.ListRolesContext(ctx)
 	if err != nil {
 		return PGOutputData{}, err
 	}
-	result.Version, err = pg.GetPostgreSQLVersion()
+	result.Version, err = pg.GetPostgreSQLVersionContext(ctx)
 	if err != nil {
 		return PGOutputData{}, err
 	}
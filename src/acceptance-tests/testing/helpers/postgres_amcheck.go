@@ -0,0 +1,193 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AmcheckSchema is the scratch schema amcheck is installed in when the
+// database does not have it yet, so that it can be dropped afterwards.
+const AmcheckSchema = "pgats_amcheck"
+
+const GetAmcheckSchemaQuery = "SELECT n.nspname FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace WHERE e.extname = 'amcheck'"
+const CreateAmcheckSchemaQuery = "CREATE SCHEMA " + AmcheckSchema
+const CreateAmcheckExtensionQuery = "CREATE EXTENSION amcheck SCHEMA " + AmcheckSchema
+const DropAmcheckQuery = "DROP SCHEMA " + AmcheckSchema + " CASCADE"
+
+// HasVerifyHeapamQuery takes the schema amcheck is installed in. An amcheck
+// created before 1.3 and never updated has no verify_heapam, even on a
+// server that ships it.
+const HasVerifyHeapamQuery = "SELECT EXISTS (SELECT 1 FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace WHERE n.nspname = $1 AND p.proname = 'verify_heapam')"
+
+// ListCheckedRelationsQuery lists the tables and materialized views, and the
+// btree indexes amcheck can verify, of a database.
+const ListCheckedRelationsQuery = "SELECT n.nspname AS schema, c.relname, CASE WHEN c.relkind = 'i' THEN 'index' ELSE 'table' END AS kind, quote_ident(n.nspname) || '.' || quote_ident(c.relname) AS regclass FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace LEFT JOIN pg_index i ON i.indexrelid = c.oid LEFT JOIN pg_am a ON a.oid = c.relam WHERE n.nspname NOT IN ('pg_catalog', 'information_schema', '" + AmcheckSchema + "') AND n.nspname NOT LIKE 'pg\\_toast%' AND n.nspname NOT LIKE 'pg\\_temp%' AND c.relpersistence != 't' AND (c.relkind IN ('r', 'm') OR (c.relkind = 'i' AND a.amname = 'btree' AND i.indisvalid AND i.indisready)) ORDER BY 1, 2"
+
+// The amcheck queries take the schema amcheck is installed in.
+const BtIndexCheckQuery = "SELECT %s.bt_index_check($1::regclass)"
+const VerifyHeapamQuery = "SELECT blkno, offnum, attnum, msg FROM %s.verify_heapam($1::regclass)"
+
+const (
+	RelationKindTable = "table"
+	RelationKindIndex = "index"
+)
+
+type PGCheckedRelation struct {
+	Schema   string `db:"schema"`
+	Name     string `db:"relname"`
+	Kind     string `db:"kind"`
+	RegClass string `db:"regclass"`
+}
+
+type PGHeapCorruption struct {
+	Block     int64  `db:"blkno"`
+	Offset    int    `db:"offnum"`
+	Attribute int    `db:"attnum"`
+	Message   string `db:"msg"`
+}
+
+func (c PGHeapCorruption) String() string {
+	result := fmt.Sprintf("block %d, offset %d", c.Block, c.Offset)
+	if c.Attribute != 0 {
+		result += fmt.Sprintf(", attribute %d", c.Attribute)
+	}
+	return result + ": " + c.Message
+}
+
+// PGRelationCheck is the outcome of verifying one table or index.
+type PGRelationCheck struct {
+	Database string
+	Schema   string
+	Name     string
+	Kind     string
+	// Checked is false for tables when amcheck has no verify_heapam.
+	Checked bool
+	// Problems is empty when no corruption was found.
+	Problems []string
+}
+
+// PGIntegrityReport lists every relation verified with amcheck.
+type PGIntegrityReport struct {
+	Relations []PGRelationCheck
+}
+
+// Corrupted returns the relations amcheck found problems in.
+func (r PGIntegrityReport) Corrupted() []PGRelationCheck {
+	var result []PGRelationCheck
+	for _, relation := range r.Relations {
+		if len(relation.Problems) > 0 {
+			result = append(result, relation)
+		}
+	}
+	return result
+}
+
+func (r PGIntegrityReport) String() string {
+	corrupted := r.Corrupted()
+	lines := []string{fmt.Sprintf("%d of %d relations corrupted", len(corrupted), len(r.Relations))}
+	for _, relation := range corrupted {
+		lines = append(lines, fmt.Sprintf("  %s %s: %s.%s", relation.Kind, relation.Database, relation.Schema, relation.Name))
+		for _, problem := range relation.Problems {
+			lines = append(lines, "    "+problem)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CheckIntegrity verifies every btree index with bt_index_check and, when
+// amcheck provides it, every table with verify_heapam in each of dbNames.
+// amcheck is installed in AmcheckSchema and removed afterwards, unless the
+// database already had it.
+func (pg PGData) CheckIntegrity(dbNames ...string) (PGIntegrityReport, error) {
+	return pg.CheckIntegrityContext(context.Background(), dbNames...)
+}
+func (pg PGData) CheckIntegrityContext(ctx context.Context, dbNames ...string) (PGIntegrityReport, error) {
+	var result PGIntegrityReport
+	sorted := append([]string{}, dbNames...)
+	sort.Strings(sorted)
+	for _, dbName := range sorted {
+		relations, err := pg.checkDatabaseIntegrity(ctx, dbName)
+		if err != nil {
+			return PGIntegrityReport{}, err
+		}
+		result.Relations = append(result.Relations, relations...)
+	}
+	return result, nil
+}
+
+func (pg PGData) checkDatabaseIntegrity(ctx context.Context, dbName string) (result []PGRelationCheck, err error) {
+	conn, err := pg.GetDBSuperUserConnectionContext(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := Query[string](ctx, conn, GetAmcheckSchemaQuery)
+	if err != nil {
+		return nil, err
+	}
+	var schema string
+	if len(schemas) > 0 {
+		schema = schemas[0]
+	} else {
+		if err := conn.ExecContext(ctx, CreateAmcheckSchemaQuery); err != nil {
+			return nil, err
+		}
+		schema = AmcheckSchema
+		defer func() {
+			if dropErr := conn.ExecContext(ctx, DropAmcheckQuery); dropErr != nil && err == nil {
+				result, err = nil, dropErr
+			}
+		}()
+		if err := conn.ExecContext(ctx, CreateAmcheckExtensionQuery); err != nil {
+			return nil, err
+		}
+	}
+
+	quotedSchema, err := QuoteIdentifier(schema)
+	if err != nil {
+		return nil, err
+	}
+	hasVerifyHeapam, err := QueryRow[bool](ctx, conn, HasVerifyHeapamQuery, schema)
+	if err != nil {
+		return nil, err
+	}
+	relations, err := Query[PGCheckedRelation](ctx, conn, ListCheckedRelationsQuery)
+	if err != nil {
+		return nil, err
+	}
+	for _, relation := range relations {
+		check := PGRelationCheck{Database: dbName, Schema: relation.Schema, Name: relation.Name, Kind: relation.Kind}
+		switch {
+		case relation.Kind == RelationKindIndex:
+			check.Checked = true
+			err := conn.ExecContext(ctx, fmt.Sprintf(BtIndexCheckQuery, quotedSchema), relation.RegClass)
+			if err != nil {
+				if !isCorruptionError(err) {
+					return nil, err
+				}
+				check.Problems = append(check.Problems, err.Error())
+			}
+		case hasVerifyHeapam:
+			check.Checked = true
+			corruptions, err := Query[PGHeapCorruption](ctx, conn, fmt.Sprintf(VerifyHeapamQuery, quotedSchema), relation.RegClass)
+			if err != nil {
+				if !isCorruptionError(err) {
+					return nil, err
+				}
+				check.Problems = append(check.Problems, err.Error())
+			}
+			for _, corruption := range corruptions {
+				check.Problems = append(check.Problems, corruption.String())
+			}
+		}
+		result = append(result, check)
+	}
+	return result, nil
+}
+
+// isCorruptionError reports whether err is one of the internal errors, such
+// as index_corrupted, amcheck raises on corruption.
+func isCorruptionError(err error) bool {
+	return strings.HasPrefix(SQLState(err), "XX")
+}
@@ -0,0 +1,95 @@
+package helpers_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+	"github.com/lib/pq"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integrity checks", func() {
+	var (
+		pg   helpers.PGData
+		mock sqlmock.Sqlmock
+	)
+
+	BeforeEach(func() {
+		var mocks map[string]sqlmock.Sqlmock
+		pg, mocks = mockSuperUserConnections("db1")
+		mock = mocks["db1"]
+	})
+
+	expectVerifyHeapam := func(schema string, available bool) {
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.HasVerifyHeapamQuery)).WithArgs(schema).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(available))
+	}
+	expectRelations := func() {
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.ListCheckedRelationsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"schema", "relname", "kind", "regclass"}).
+				AddRow("public", "users", "table", "public.users").
+				AddRow("public", "users_name_idx", "index", "public.users_name_idx").
+				AddRow("public", "users_pkey", "index", "public.users_pkey"))
+	}
+	corruption := &pq.Error{Code: "XX002", Message: `item order invariant violated for index "users_name_idx"`}
+
+	It("Installs amcheck in a scratch schema and reports every relation", func() {
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.GetAmcheckSchemaQuery)).WillReturnRows(sqlmock.NewRows([]string{"nspname"}))
+		mock.ExpectExec(regexp.QuoteMeta(helpers.CreateAmcheckSchemaQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(helpers.CreateAmcheckExtensionQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectVerifyHeapam(helpers.AmcheckSchema, true)
+		expectRelations()
+		mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(helpers.VerifyHeapamQuery, `"pgats_amcheck"`))).WithArgs("public.users").WillReturnRows(
+			sqlmock.NewRows([]string{"blkno", "offnum", "attnum", "msg"}).AddRow(int64(3), 7, nil, "xmin 1234 precedes relation freeze threshold 0:5678"))
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(helpers.BtIndexCheckQuery, `"pgats_amcheck"`))).WithArgs("public.users_name_idx").WillReturnError(corruption)
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(helpers.BtIndexCheckQuery, `"pgats_amcheck"`))).WithArgs("public.users_pkey").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(helpers.DropAmcheckQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		report, err := pg.CheckIntegrityContext(context.Background(), "db1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Relations).To(Equal([]helpers.PGRelationCheck{
+			{Database: "db1", Schema: "public", Name: "users", Kind: helpers.RelationKindTable, Checked: true, Problems: []string{"block 3, offset 7: xmin 1234 precedes relation freeze threshold 0:5678"}},
+			{Database: "db1", Schema: "public", Name: "users_name_idx", Kind: helpers.RelationKindIndex, Checked: true, Problems: []string{corruption.Error()}},
+			{Database: "db1", Schema: "public", Name: "users_pkey", Kind: helpers.RelationKindIndex, Checked: true},
+		}))
+		Expect(report.Corrupted()).To(HaveLen(2))
+		Expect(report.String()).To(Equal(`2 of 3 relations corrupted
+  table db1: public.users
+    block 3, offset 7: xmin 1234 precedes relation freeze threshold 0:5678
+  index db1: public.users_name_idx
+    ` + corruption.Error()))
+	})
+
+	It("Uses an existing amcheck and skips tables when it has no verify_heapam", func() {
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.GetAmcheckSchemaQuery)).WillReturnRows(sqlmock.NewRows([]string{"nspname"}).AddRow("public"))
+		expectVerifyHeapam("public", false)
+		expectRelations()
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(helpers.BtIndexCheckQuery, `"public"`))).WithArgs("public.users_name_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(helpers.BtIndexCheckQuery, `"public"`))).WithArgs("public.users_pkey").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		report, err := pg.CheckIntegrityContext(context.Background(), "db1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Relations).To(Equal([]helpers.PGRelationCheck{
+			{Database: "db1", Schema: "public", Name: "users", Kind: helpers.RelationKindTable},
+			{Database: "db1", Schema: "public", Name: "users_name_idx", Kind: helpers.RelationKindIndex, Checked: true},
+			{Database: "db1", Schema: "public", Name: "users_pkey", Kind: helpers.RelationKindIndex, Checked: true},
+		}))
+		Expect(report.Corrupted()).To(BeEmpty())
+	})
+
+	It("Fails on other errors and still removes amcheck", func() {
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.GetAmcheckSchemaQuery)).WillReturnRows(sqlmock.NewRows([]string{"nspname"}))
+		mock.ExpectExec(regexp.QuoteMeta(helpers.CreateAmcheckSchemaQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(helpers.CreateAmcheckExtensionQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectVerifyHeapam(helpers.AmcheckSchema, true)
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.ListCheckedRelationsQuery)).WillReturnError(genericError)
+		mock.ExpectExec(regexp.QuoteMeta(helpers.DropAmcheckQuery)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		_, err := pg.CheckIntegrityContext(context.Background(), "db1")
+		Expect(err).To(MatchError(genericError))
+	})
+})
@@ -0,0 +1,186 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const ServerVersionNumQuery = "SHOW server_version_num"
+
+const UnsupportedCatalogFeatureErr = "%s is unsupported on this version: the server runs %s, %s or later is required"
+
+// PGCatalogFeature is a piece of catalog introspection whose query depends
+// on the server major version.
+type PGCatalogFeature struct {
+	Name string
+	// Queries are sorted by decreasing MinVersion; the first one the server
+	// satisfies is used.
+	Queries []PGVersionedQuery
+}
+
+// PGVersionedQuery is used from MinVersion on. The zero MinVersion is met by
+// every server.
+type PGVersionedQuery struct {
+	MinVersion PGVersionNumber
+	Query      string
+}
+
+var CheckpointerStatsFeature = PGCatalogFeature{
+	Name: "checkpointer statistics",
+	Queries: []PGVersionedQuery{
+		{mustParsePGVersion("17"), "SELECT num_timed, num_requested, buffers_written FROM pg_stat_checkpointer"},
+		{PGVersionNumber{}, "SELECT checkpoints_timed AS num_timed, checkpoints_req AS num_requested, buffers_checkpoint AS buffers_written FROM pg_stat_bgwriter"},
+	},
+}
+
+var IdentFileMappingsFeature = PGCatalogFeature{
+	Name: "pg_ident_file_mappings",
+	Queries: []PGVersionedQuery{
+		{mustParsePGVersion("16"), "SELECT map_number, file_name, line_number, map_name, sys_name, pg_username, error FROM pg_ident_file_mappings ORDER BY map_number"},
+		{mustParsePGVersion("15"), "SELECT line_number AS map_number, '' AS file_name, line_number, map_name, sys_name, pg_username, error FROM pg_ident_file_mappings ORDER BY line_number"},
+	},
+}
+
+var DatabaseCollationsFeature = PGCatalogFeature{
+	Name: "database collation versions",
+	Queries: []PGVersionedQuery{
+		{mustParsePGVersion("15"), "SELECT datname, datcollversion, pg_database_collation_actual_version(oid) AS actual_version FROM pg_database WHERE datallowconn ORDER BY datname"},
+	},
+}
+
+// DatabaseLocalesFeature lists the databases with their encoding and locale.
+// Before PostgreSQL 15 every database uses the libc locale provider.
+var DatabaseLocalesFeature = PGCatalogFeature{
+	Name: "database locales",
+	Queries: []PGVersionedQuery{
+		{mustParsePGVersion("15"), "SELECT datname, pg_encoding_to_char(encoding) AS encoding, datcollate, datctype, CASE datlocprovider WHEN 'b' THEN 'builtin' WHEN 'i' THEN 'icu' ELSE 'libc' END AS locale_provider FROM pg_database WHERE NOT datistemplate ORDER BY datname"},
+		{PGVersionNumber{}, "SELECT datname, pg_encoding_to_char(encoding) AS encoding, datcollate, datctype, 'libc' AS locale_provider FROM pg_database WHERE NOT datistemplate ORDER BY datname"},
+	},
+}
+
+var CollationVersionsFeature = PGCatalogFeature{
+	Name: "collation versions",
+	Queries: []PGVersionedQuery{
+		{mustParsePGVersion("10"), "SELECT collname, collversion, pg_collation_actual_version(oid) AS actual_version FROM pg_collation WHERE collversion IS NOT NULL ORDER BY collname"},
+	},
+}
+
+var IOStatsFeature = PGCatalogFeature{
+	Name: "pg_stat_io",
+	Queries: []PGVersionedQuery{
+		{mustParsePGVersion("16"), "SELECT backend_type, object, context, coalesce(reads, 0) AS reads, coalesce(writes, 0) AS writes, coalesce(extends, 0) AS extends FROM pg_stat_io"},
+	},
+}
+
+type PGCheckpointerStats struct {
+	NumTimed       int64 `db:"num_timed"`
+	NumRequested   int64 `db:"num_requested"`
+	BuffersWritten int64 `db:"buffers_written"`
+}
+
+type PGIdentMapping struct {
+	MapNumber  int    `db:"map_number"`
+	FileName   string `db:"file_name"`
+	LineNumber int    `db:"line_number"`
+	MapName    string `db:"map_name"`
+	SysName    string `db:"sys_name"`
+	PGUsername string `db:"pg_username"`
+	Error      string `db:"error"`
+}
+
+type PGDatabaseCollation struct {
+	Name          string `db:"datname"`
+	Version       string `db:"datcollversion"`
+	ActualVersion string `db:"actual_version"`
+}
+
+type PGCollationVersion struct {
+	Name          string `db:"collname"`
+	Version       string `db:"collversion"`
+	ActualVersion string `db:"actual_version"`
+}
+
+type PGIOStats struct {
+	BackendType string `db:"backend_type"`
+	Object      string `db:"object"`
+	Context     string `db:"context"`
+	Reads       int64  `db:"reads"`
+	Writes      int64  `db:"writes"`
+	Extends     int64  `db:"extends"`
+}
+
+// pgServerInfo caches what is read from the server once per pool. The pool
+// outlives restarts and major upgrades, so CloseConnections clears it.
+type pgServerInfo struct {
+	mu         sync.Mutex
+	versionNum int
+}
+
+func (s *pgServerInfo) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versionNum = 0
+}
+
+// ServerVersionNum returns server_version_num, read once per pool.
+func (pg PGConn) ServerVersionNum(ctx context.Context) (int, error) {
+	if pg.server == nil {
+		return QueryRow[int](ctx, pg, ServerVersionNumQuery)
+	}
+	pg.server.mu.Lock()
+	defer pg.server.mu.Unlock()
+	if pg.server.versionNum == 0 {
+		versionNum, err := QueryRow[int](ctx, pg, ServerVersionNumQuery)
+		if err != nil {
+			return 0, err
+		}
+		pg.server.versionNum = versionNum
+	}
+	return pg.server.versionNum, nil
+}
+
+// ServerVersion returns the version of the server pg is connected to, as
+// read from server_version_num.
+func (pg PGConn) ServerVersion(ctx context.Context) (PGVersionNumber, error) {
+	versionNum, err := pg.ServerVersionNum(ctx)
+	if err != nil {
+		return PGVersionNumber{}, err
+	}
+	return PGVersionFromNum(versionNum), nil
+}
+
+// CatalogQuery returns the query implementing feature on the server pg is
+// connected to.
+func (pg PGConn) CatalogQuery(ctx context.Context, feature PGCatalogFeature) (string, error) {
+	version, err := pg.ServerVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	return feature.QueryFor(version)
+}
+
+// SupportedBy reports whether the feature exists on version.
+func (f PGCatalogFeature) SupportedBy(version PGVersionNumber) bool {
+	return version.Compare(f.Queries[len(f.Queries)-1].MinVersion) >= 0
+}
+
+// QueryFor returns the query implementing the feature on version.
+func (f PGCatalogFeature) QueryFor(version PGVersionNumber) (string, error) {
+	for _, query := range f.Queries {
+		if version.Compare(query.MinVersion) >= 0 {
+			return query.Query, nil
+		}
+	}
+	return "", fmt.Errorf(UnsupportedCatalogFeatureErr, f.Name, version, f.Queries[len(f.Queries)-1].MinVersion)
+}
+
+// QueryCatalog runs the query implementing feature on conn and scans the
+// rows into T.
+func QueryCatalog[T any](ctx context.Context, conn PGConn, feature PGCatalogFeature, args ...interface{}) ([]T, error) {
+	query, err := conn.CatalogQuery(ctx, feature)
+	if err != nil {
+		return nil, err
+	}
+	return Query[T](ctx, conn, query, args...)
+}
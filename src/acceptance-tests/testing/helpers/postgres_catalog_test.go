@@ -0,0 +1,136 @@
+package helpers_test
+
+import (
+	"context"
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Catalog queries", func() {
+	var (
+		pg   helpers.PGData
+		conn helpers.PGConn
+		mock sqlmock.Sqlmock
+		ctx  context.Context
+	)
+
+	BeforeEach(func() {
+		pg = helpers.PGData{Conns: helpers.NewPGConnRegistry()}
+		db, m, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		mock = m
+		conn = pg.AddConnection(helpers.DefaultDB, pg.Data.DefUser, db)
+		ctx = context.Background()
+	})
+	AfterEach(func() {
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+		pg.CloseConnections()
+	})
+
+	expectVersion := func(versionNum string) {
+		mock.ExpectQuery(helpers.ServerVersionNumQuery).WillReturnRows(sqlmock.NewRows([]string{"server_version_num"}).AddRow(versionNum))
+	}
+
+	DescribeTable("Choosing the query for the running major",
+		func(feature helpers.PGCatalogFeature, versionNum int, expected string) {
+			query, err := feature.QueryFor(helpers.PGVersionFromNum(versionNum))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(query).To(ContainSubstring(expected))
+		},
+		Entry("checkpointer on 17", helpers.CheckpointerStatsFeature, 170002, "FROM pg_stat_checkpointer"),
+		Entry("checkpointer on 16", helpers.CheckpointerStatsFeature, 160006, "FROM pg_stat_bgwriter"),
+		Entry("ident mappings on 18", helpers.IdentFileMappingsFeature, 180000, "map_number, file_name"),
+		Entry("ident mappings on 15", helpers.IdentFileMappingsFeature, 150010, "'' AS file_name"),
+		Entry("collations on 15", helpers.DatabaseCollationsFeature, 150000, "datcollversion"),
+		Entry("io stats on 16", helpers.IOStatsFeature, 160000, "FROM pg_stat_io"),
+		Entry("database locales on 15", helpers.DatabaseLocalesFeature, 150000, "datlocprovider"),
+		Entry("database locales on 14", helpers.DatabaseLocalesFeature, 140011, "'libc' AS locale_provider"),
+	)
+
+	DescribeTable("Refusing features the running major does not have",
+		func(feature helpers.PGCatalogFeature, versionNum int, expected string) {
+			_, err := feature.QueryFor(helpers.PGVersionFromNum(versionNum))
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("io stats on 15", helpers.IOStatsFeature, 150008, "pg_stat_io is unsupported on this version: the server runs 15.8, 16 or later is required"),
+		Entry("collations on 14", helpers.DatabaseCollationsFeature, 140011, "database collation versions is unsupported on this version: the server runs 14.11, 15 or later is required"),
+	)
+
+	DescribeTable("Telling whether the running major has a feature",
+		func(feature helpers.PGCatalogFeature, versionNum int, expected bool) {
+			Expect(feature.SupportedBy(helpers.PGVersionFromNum(versionNum))).To(Equal(expected))
+		},
+		Entry("checkpointer on 9.6", helpers.CheckpointerStatsFeature, 90624, true),
+		Entry("database collations on 15", helpers.DatabaseCollationsFeature, 150000, true),
+		Entry("database collations on 14", helpers.DatabaseCollationsFeature, 140011, false),
+		Entry("collations on 10", helpers.CollationVersionsFeature, 100000, true),
+		Entry("collations on 9.6", helpers.CollationVersionsFeature, 90624, false),
+	)
+
+	It("Reads server_version_num once per connection", func() {
+		expectVersion("170002")
+		mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_checkpointer")).WillReturnRows(
+			sqlmock.NewRows([]string{"num_timed", "num_requested", "buffers_written"}).AddRow(int64(10), int64(2), int64(300)))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_io")).WillReturnRows(
+			sqlmock.NewRows([]string{"backend_type", "object", "context", "reads", "writes", "extends"}).AddRow("client backend", "relation", "normal", int64(1), int64(2), int64(3)))
+
+		stats, err := helpers.QueryCatalog[helpers.PGCheckpointerStats](ctx, conn, helpers.CheckpointerStatsFeature)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats).To(Equal([]helpers.PGCheckpointerStats{{NumTimed: 10, NumRequested: 2, BuffersWritten: 300}}))
+
+		again, err := pg.GetDefaultConnection()
+		Expect(err).NotTo(HaveOccurred())
+		io, err := helpers.QueryCatalog[helpers.PGIOStats](ctx, again, helpers.IOStatsFeature)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(io).To(Equal([]helpers.PGIOStats{{BackendType: "client backend", Object: "relation", Context: "normal", Reads: 1, Writes: 2, Extends: 3}}))
+	})
+
+	It("Reads server_version_num again once the connections are closed, as around an upgrade", func() {
+		expectVersion("140011")
+		before, err := conn.ServerVersionNum(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(before).To(Equal(140011))
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+
+		pg.CloseConnections()
+		db, m, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		mock = m
+		pg.AddConnection(helpers.DefaultDB, pg.Data.DefUser, db)
+		expectVersion("180000")
+		upgraded, err := pg.GetDefaultConnection()
+		Expect(err).NotTo(HaveOccurred())
+		after, err := upgraded.ServerVersionNum(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after).To(Equal(180000))
+	})
+
+	It("Reads the server version from server_version_num", func() {
+		expectVersion("90624")
+		version, err := conn.ServerVersion(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal(helpers.PGVersionNumber{Numbers: []int{9, 6, 24}}))
+	})
+
+	It("Fails without querying the catalog on an older major", func() {
+		expectVersion("150008")
+		_, err := helpers.QueryCatalog[helpers.PGIOStats](ctx, conn, helpers.IOStatsFeature)
+		Expect(err).To(MatchError(ContainSubstring("pg_stat_io is unsupported on this version")))
+	})
+
+	It("Does not cache a failure to read the version", func() {
+		mock.ExpectQuery(helpers.ServerVersionNumQuery).WillReturnError(genericError)
+		expectVersion("160004")
+
+		_, err := conn.ServerVersionNum(ctx)
+		Expect(err).To(MatchError(genericError))
+		versionNum, err := conn.ServerVersionNum(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versionNum).To(Equal(160004))
+	})
+})
@@ -0,0 +1,129 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultCollation is the name pg_collation gives to the collation of the
+// database, the one initdb --locale sets.
+const DefaultCollation = "default"
+
+// ListCollationIndexesQuery lists the collations each user index sorts its
+// keys by.
+const ListCollationIndexesQuery = "SELECT DISTINCT n.nspname AS schema, t.relname AS tablename, i.relname AS indexname, c.collname AS collation FROM pg_index x JOIN pg_class i ON i.oid = x.indexrelid JOIN pg_class t ON t.oid = x.indrelid JOIN pg_namespace n ON n.oid = i.relnamespace CROSS JOIN LATERAL unnest(x.indcollation::oid[]) AS k(oid) JOIN pg_collation c ON c.oid = k.oid WHERE n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg\\_toast%' ORDER BY 1, 2, 3, 4"
+
+type PGCollationIndex struct {
+	Schema    string `db:"schema"`
+	Table     string `db:"tablename"`
+	Index     string `db:"indexname"`
+	Collation string `db:"collation"`
+}
+
+// PGCollationDrift is a collation whose version recorded in the catalog is
+// not the one the operating system provides any more, as after a glibc
+// upgrade. The indexes sorted by it may be corrupt until they are rebuilt.
+type PGCollationDrift struct {
+	Database string
+	// Collation is DefaultCollation for the collation of the database.
+	Collation     string
+	Version       string
+	ActualVersion string
+	// Indexes are the indexes needing a REINDEX, as "schema.index".
+	Indexes []string
+}
+
+// InUse reports whether the drift needs action: the collation is the one of
+// the database or an index sorts by it. Imported collations nothing uses
+// can be refreshed at leisure.
+func (d PGCollationDrift) InUse() bool {
+	return d.Collation == DefaultCollation || len(d.Indexes) > 0
+}
+
+// Drifted reports whether the recorded version differs from the actual one.
+// Collations without a recorded version, such as C, are never reported.
+func (c PGCollationVersion) Drifted() bool {
+	return c.Version != "" && c.Version != c.ActualVersion
+}
+
+// GetCollationDrift compares the recorded and actual versions of the
+// collation of every database and of the collations in each of them, and
+// lists the indexes they affect. The collation of the database is only
+// versioned from PostgreSQL 15 on, and the other collations from 10 on.
+func (pg PGData) GetCollationDrift() ([]PGCollationDrift, error) {
+	return pg.GetCollationDriftContext(context.Background())
+}
+func (pg PGData) GetCollationDriftContext(ctx context.Context) ([]PGCollationDrift, error) {
+	conn, err := pg.GetSuperUserConnectionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	version, err := conn.ServerVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	databases, err := Query[PGDatabase](ctx, conn, ListDatabasesQuery)
+	if err != nil {
+		return nil, err
+	}
+	databaseVersions := make(map[string]PGCollationVersion)
+	if DatabaseCollationsFeature.SupportedBy(version) {
+		rows, err := QueryCatalog[PGDatabaseCollation](ctx, conn, DatabaseCollationsFeature)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			databaseVersions[row.Name] = PGCollationVersion{Name: DefaultCollation, Version: row.Version, ActualVersion: row.ActualVersion}
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, db := range databases {
+		names[db.Name] = true
+	}
+	var result []PGCollationDrift
+	for _, dbName := range sortedKeys(names) {
+		var drifted []PGCollationVersion
+		if version, ok := databaseVersions[dbName]; ok && version.Drifted() {
+			drifted = append(drifted, version)
+		}
+		dbConn, err := pg.GetDBSuperUserConnectionContext(ctx, dbName)
+		if err != nil {
+			return nil, err
+		}
+		if query, err := CollationVersionsFeature.QueryFor(version); err == nil {
+			collations, err := Query[PGCollationVersion](ctx, dbConn, query)
+			if err != nil {
+				return nil, err
+			}
+			for _, collation := range collations {
+				if collation.Drifted() {
+					drifted = append(drifted, collation)
+				}
+			}
+		}
+		if len(drifted) == 0 {
+			continue
+		}
+
+		indexes, err := Query[PGCollationIndex](ctx, dbConn, ListCollationIndexesQuery)
+		if err != nil {
+			return nil, err
+		}
+		for _, collation := range drifted {
+			drift := PGCollationDrift{
+				Database:      dbName,
+				Collation:     collation.Name,
+				Version:       collation.Version,
+				ActualVersion: collation.ActualVersion,
+			}
+			for _, index := range indexes {
+				if index.Collation == collation.Name {
+					drift.Indexes = append(drift.Indexes, fmt.Sprintf("%s.%s", index.Schema, index.Index))
+				}
+			}
+			result = append(result, drift)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package helpers_test
+
+import (
+	"context"
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collation versions", func() {
+	var (
+		pg    helpers.PGData
+		mocks map[string]sqlmock.Sqlmock
+	)
+
+	BeforeEach(func() {
+		pg, mocks = mockSuperUserConnections(helpers.DefaultDB, "db1")
+	})
+
+	expectDatabases := func(versionNum string) {
+		mocks[helpers.DefaultDB].ExpectQuery(helpers.ServerVersionNumQuery).WillReturnRows(sqlmock.NewRows([]string{"server_version_num"}).AddRow(versionNum))
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.ListDatabasesQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"datname"}).AddRow(helpers.DefaultDB).AddRow("db1"))
+	}
+	collationColumns := []string{"collname", "collversion", "actual_version"}
+
+	It("Lists the drifted collations of every database and the indexes they affect", func() {
+		expectDatabases("160006")
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.DatabaseCollationsFeature.Queries[0].Query)).WillReturnRows(
+			sqlmock.NewRows([]string{"datname", "datcollversion", "actual_version"}).
+				AddRow("db1", "2.35", "2.39").
+				AddRow(helpers.DefaultDB, "2.39", "2.39").
+				AddRow("template1", nil, nil))
+		mocks["db1"].ExpectQuery(regexp.QuoteMeta(helpers.CollationVersionsFeature.Queries[0].Query)).WillReturnRows(
+			sqlmock.NewRows(collationColumns).
+				AddRow("en-x-icu", "153.112", "153.112").
+				AddRow("de_DE", "2.35", "2.39"))
+		mocks["db1"].ExpectQuery(regexp.QuoteMeta(helpers.ListCollationIndexesQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"schema", "tablename", "indexname", "collation"}).
+				AddRow("public", "users", "users_name_idx", "default").
+				AddRow("public", "users", "users_name_de_idx", "de_DE").
+				AddRow("public", "users", "users_email_idx", "default").
+				AddRow("public", "users", "users_name_icu_idx", "en-x-icu"))
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.CollationVersionsFeature.Queries[0].Query)).WillReturnRows(
+			sqlmock.NewRows(collationColumns).AddRow("en-x-icu", "153.112", "153.112"))
+
+		drifts, err := pg.GetCollationDriftContext(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(Equal([]helpers.PGCollationDrift{
+			{Database: "db1", Collation: helpers.DefaultCollation, Version: "2.35", ActualVersion: "2.39", Indexes: []string{"public.users_name_idx", "public.users_email_idx"}},
+			{Database: "db1", Collation: "de_DE", Version: "2.35", ActualVersion: "2.39", Indexes: []string{"public.users_name_de_idx"}},
+		}))
+	})
+
+	It("Only checks the collations themselves before PostgreSQL 15", func() {
+		expectDatabases("140011")
+		mocks["db1"].ExpectQuery(regexp.QuoteMeta(helpers.CollationVersionsFeature.Queries[0].Query)).WillReturnRows(
+			sqlmock.NewRows(collationColumns))
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.CollationVersionsFeature.Queries[0].Query)).WillReturnRows(
+			sqlmock.NewRows(collationColumns).AddRow("fr_FR", "2.28", "2.31"))
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.ListCollationIndexesQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"schema", "tablename", "indexname", "collation"}))
+
+		drifts, err := pg.GetCollationDriftContext(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(Equal([]helpers.PGCollationDrift{
+			{Database: helpers.DefaultDB, Collation: "fr_FR", Version: "2.28", ActualVersion: "2.31"},
+		}))
+	})
+
+	It("Fails if a database cannot be read", func() {
+		expectDatabases("160006")
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.DatabaseCollationsFeature.Queries[0].Query)).WillReturnRows(
+			sqlmock.NewRows([]string{"datname", "datcollversion", "actual_version"}))
+		mocks["db1"].ExpectQuery(regexp.QuoteMeta(helpers.CollationVersionsFeature.Queries[0].Query)).WillReturnError(genericError)
+
+		_, err := pg.GetCollationDriftContext(context.Background())
+		Expect(err).To(MatchError(genericError))
+	})
+})
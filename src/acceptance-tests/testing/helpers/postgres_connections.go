@@ -0,0 +1,216 @@
+package helpers
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PGConnKey identifies a connection pool: the same database opened by the
+// same user with a different TLS or authentication mode is a different pool.
+type PGConnKey struct {
+	TargetDB string
+	User     string
+	Mode     string
+}
+
+func (k PGConnKey) String() string {
+	return fmt.Sprintf("%s@%s (%s)", k.User, k.TargetDB, k.Mode)
+}
+
+// PGConnRegistry holds the connection pools opened by a PGData. It is shared
+// by every copy of the PGData that owns it and is safe for concurrent use.
+type PGConnRegistry struct {
+	mu     sync.Mutex
+	conns  map[PGConnKey]PGConn
+	opened int
+	closed int
+}
+
+type PGConnStats struct {
+	Key   PGConnKey
+	Open  int
+	InUse int
+}
+
+type PGConnReport struct {
+	Opened int
+	Closed int
+	Open   []PGConnStats
+	Leaked []PGConnStats
+}
+
+// registries holds the registries with open pools, so that suites can report
+// and close them. A registry leaves it once its pools are closed and is back
+// when it opens new ones. poolsOpened and poolsClosed count the pools of
+// every registry. registriesMu is taken before the mutex of a registry.
+var (
+	registriesMu sync.Mutex
+	registries   = make(map[*PGConnRegistry]bool)
+	poolsOpened  int
+	poolsClosed  int
+)
+
+func NewPGConnRegistry() *PGConnRegistry {
+	return &PGConnRegistry{conns: make(map[PGConnKey]PGConn)}
+}
+
+func (r *PGConnRegistry) Get(key PGConnKey) (PGConn, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conn, ok := r.conns[key]
+	return conn, ok
+}
+
+// Add registers conn under key. If another goroutine registered a pool for
+// the same key in the meantime, conn is closed and the existing pool is
+// returned instead.
+func (r *PGConnRegistry) Add(key PGConnKey, conn PGConn) PGConn {
+	registriesMu.Lock()
+	defer registriesMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.opened++
+	poolsOpened++
+	if existing, ok := r.conns[key]; ok {
+		conn.DB.Close()
+		r.closed++
+		poolsClosed++
+		return existing
+	}
+	r.conns[key] = conn
+	registries[r] = true
+	return conn
+}
+
+func (r *PGConnRegistry) CloseAll() {
+	registriesMu.Lock()
+	defer registriesMu.Unlock()
+	r.closeAll()
+}
+
+// closeAll is CloseAll for callers holding registriesMu.
+func (r *PGConnRegistry) closeAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, conn := range r.conns {
+		conn.DB.Close()
+		if conn.server != nil {
+			conn.server.reset()
+		}
+		r.closed++
+		poolsClosed++
+		delete(r.conns, key)
+	}
+	delete(registries, r)
+}
+
+func (r *PGConnRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+// Report lists the pools still open; pools with connections checked out
+// (unclosed rows or unfinished transactions) are also listed as leaked.
+func (r *PGConnRegistry) Report() PGConnReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := PGConnReport{Opened: r.opened, Closed: r.closed}
+	for _, key := range r.sortedKeys() {
+		dbStats := r.conns[key].DB.Stats()
+		stats := PGConnStats{Key: key, Open: dbStats.OpenConnections, InUse: dbStats.InUse}
+		report.Open = append(report.Open, stats)
+		if stats.InUse > 0 {
+			report.Leaked = append(report.Leaked, stats)
+		}
+	}
+	return report
+}
+
+func (r *PGConnRegistry) sortedKeys() []PGConnKey {
+	keys := make([]PGConnKey, 0, len(r.conns))
+	for key := range r.conns {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
+}
+
+func (r PGConnReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d connection pools opened, %d closed, %d still open, %d leaked", r.Opened, r.Closed, len(r.Open), len(r.Leaked))
+	for _, stats := range r.Open {
+		fmt.Fprintf(&b, "\n  open:   %s connections=%d in_use=%d", stats.Key, stats.Open, stats.InUse)
+	}
+	for _, stats := range r.Leaked {
+		fmt.Fprintf(&b, "\n  leaked: %s in_use=%d", stats.Key, stats.InUse)
+	}
+	return b.String()
+}
+
+// ConnectionsReport counts the pools every registry opened and closed so
+// far, and lists those still open. Suites call it when they end to surface
+// pools that were never closed.
+func ConnectionsReport() PGConnReport {
+	registriesMu.Lock()
+	defer registriesMu.Unlock()
+	result := PGConnReport{Opened: poolsOpened, Closed: poolsClosed}
+	for r := range registries {
+		report := r.Report()
+		result.Open = append(result.Open, report.Open...)
+		result.Leaked = append(result.Leaked, report.Leaked...)
+	}
+	sortStats := func(stats []PGConnStats) {
+		sort.Slice(stats, func(i, j int) bool { return stats[i].Key.String() < stats[j].Key.String() })
+	}
+	sortStats(result.Open)
+	sortStats(result.Leaked)
+	return result
+}
+
+func CloseAllConnections() {
+	registriesMu.Lock()
+	defer registriesMu.Unlock()
+	for r := range registries {
+		r.closeAll()
+	}
+}
+
+func (pg PGData) connKey(dbname string, user User) PGConnKey {
+	auth := "password"
+	if user.Password == "" {
+		auth = "cert"
+	}
+	mode := fmt.Sprintf("sslmode=%s", pg.Data.SSLMode)
+	if pg.Data.SSLNegotiation != "" {
+		mode = fmt.Sprintf("%s sslnegotiation=%s", mode, pg.Data.SSLNegotiation)
+	}
+	if pg.Data.Driver != "" {
+		mode = fmt.Sprintf("%s driver=%s", mode, pg.Data.Driver)
+	}
+	return PGConnKey{
+		TargetDB: dbname,
+		User:     user.Name,
+		Mode:     fmt.Sprintf("%s auth=%s", mode, auth),
+	}
+}
+
+// AddConnection registers an already opened pool for dbname and user.
+func (pg *PGData) AddConnection(dbname string, user User, db *sql.DB) PGConn {
+	if pg.Conns == nil {
+		pg.Conns = NewPGConnRegistry()
+	}
+	conn := PGConn{
+		TargetDB: dbname,
+		User:     user.Name,
+		password: user.Password,
+		Timeout:  pg.Data.QueryTimeout,
+		Driver:   pg.Data.Driver,
+		DB:       db,
+		server:   &pgServerInfo{},
+	}
+	return pg.Conns.Add(pg.connKey(dbname, user), conn)
+}
@@ -0,0 +1,155 @@
+package helpers_test
+
+import (
+	"sync"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection registry", func() {
+	var (
+		pg    helpers.PGData
+		admin helpers.User
+		user  helpers.User
+	)
+
+	BeforeEach(func() {
+		admin = helpers.User{Name: "superUser", Password: "superPassword"}
+		user = helpers.User{Name: "defUser", Password: "defPassword"}
+		pg = helpers.PGData{
+			Data: helpers.PGCommon{
+				SSLMode:   "disable",
+				DefUser:   user,
+				AdminUser: admin,
+			},
+			Conns: helpers.NewPGConnRegistry(),
+		}
+	})
+	AfterEach(func() {
+		pg.CloseConnections()
+	})
+
+	It("Reuses the pool registered for the same database, user and mode", func() {
+		db, _, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		pg.AddConnection("db1", user, db)
+
+		conn, err := pg.GetDBConnectionForUser("db1", user)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.DB).To(BeIdenticalTo(db))
+		conn, err = pg.GetDBConnection("db1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.DB).To(BeIdenticalTo(db))
+		Expect(pg.Conns.Len()).To(Equal(1))
+	})
+
+	It("Keeps pools of different users apart", func() {
+		db, _, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		dbsuper, _, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		pg.AddConnection("db1", user, db)
+		pg.AddConnection("db1", admin, dbsuper)
+
+		conn, err := pg.GetDBConnectionForUser("db1", admin)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.DB).To(BeIdenticalTo(dbsuper))
+		_, err = pg.GetDBConnectionForUser("db2", admin)
+		Expect(err).To(MatchError(helpers.NoConnectionAvailableErr))
+		_, err = pg.GetDBConnectionForUser("db1", helpers.User{})
+		Expect(err).To(MatchError(helpers.NoConnectionAvailableErr))
+	})
+
+	It("Does not reuse a pool opened with another sslmode", func() {
+		db, _, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		pg.AddConnection("db1", user, db)
+		pg.Data.SSLMode = "require"
+
+		_, err = pg.GetDBConnectionForUser("db1", user)
+		Expect(err).To(MatchError(helpers.NoConnectionAvailableErr))
+	})
+
+	It("Shares the registry between copies of PGData", func() {
+		db, _, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		copied := pg
+		copied.AddConnection("db1", user, db)
+
+		Expect(pg.Conns.Len()).To(Equal(1))
+		pg.CloseConnections()
+		Expect(copied.Conns.Len()).To(BeZero())
+	})
+
+	It("Keeps a single pool when registered concurrently", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				db, _, err := sqlmock.New()
+				Expect(err).NotTo(HaveOccurred())
+				pg.AddConnection("db1", user, db)
+			}()
+		}
+		wg.Wait()
+
+		Expect(pg.Conns.Len()).To(Equal(1))
+		report := pg.Conns.Report()
+		Expect(report.Opened).To(Equal(10))
+		Expect(report.Closed).To(Equal(9))
+		Expect(report.Open).To(HaveLen(1))
+	})
+
+	It("Reports pools with connections still in use as leaked", func() {
+		db, mock, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		conn := pg.AddConnection("db1", user, db)
+		mock.ExpectBegin()
+		txn, err := conn.DB.Begin()
+		Expect(err).NotTo(HaveOccurred())
+
+		report := pg.Conns.Report()
+		Expect(report.Leaked).To(HaveLen(1))
+		Expect(report.Leaked[0].Key.TargetDB).To(Equal("db1"))
+		Expect(report.String()).To(ContainSubstring("leaked: defUser@db1"))
+
+		mock.ExpectRollback()
+		Expect(txn.Rollback()).To(Succeed())
+		Expect(pg.Conns.Report().Leaked).To(BeEmpty())
+	})
+
+	It("Includes every registry in the suite report", func() {
+		db, _, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		pg.AddConnection("db-report", user, db)
+
+		report := helpers.ConnectionsReport()
+		Expect(report.String()).To(ContainSubstring("defUser@db-report"))
+		pg.CloseConnections()
+		Expect(helpers.ConnectionsReport().String()).NotTo(ContainSubstring("defUser@db-report"))
+	})
+
+	It("Keeps counting the pools of registries whose pools were closed", func() {
+		before := helpers.ConnectionsReport()
+		db, _, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		pg.AddConnection("db-closed", user, db)
+		pg.CloseConnections()
+
+		report := helpers.ConnectionsReport()
+		Expect(report.Opened).To(Equal(before.Opened + 1))
+		Expect(report.Closed).To(Equal(before.Closed + 1))
+		Expect(report.Open).To(HaveLen(len(before.Open)))
+
+		db, _, err = sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		pg.AddConnection("db-reopened", user, db)
+		Expect(helpers.ConnectionsReport().String()).To(ContainSubstring("defUser@db-reopened"))
+	})
+})
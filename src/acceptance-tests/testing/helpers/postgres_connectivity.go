@@ -0,0 +1,276 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	AuthPassword = "password"
+	AuthCert     = "cert"
+)
+
+// Kinds of source address, matching the way pg_hba.conf tells them apart.
+const (
+	// SourceLocal connects through the Unix socket on the postgres VM.
+	SourceLocal = "local"
+	// SourceLoopback connects to 127.0.0.1 from the postgres VM.
+	SourceLoopback = "loopback"
+	// SourceRemote connects over the network from the test runner.
+	SourceRemote = "remote"
+)
+
+const CommandSourceErr = "%v: %s"
+
+// PGProbeSource opens a connection from a given source address.
+type PGProbeSource interface {
+	Name() string
+	Kind() string
+	Connect(ctx context.Context, pg PGData, dbname string, user User) error
+}
+
+// RemoteSource connects from the test runner with the driver selected in pg.
+type RemoteSource struct{}
+
+func (RemoteSource) Name() string { return SourceRemote }
+func (RemoteSource) Kind() string { return SourceRemote }
+
+func (RemoteSource) Connect(ctx context.Context, pg PGData, dbname string, user User) error {
+	driver, err := GetDriver(pg.Data.Driver)
+	if err != nil {
+		return err
+	}
+	db, err := driver.Open(pg.ConnectionParams(dbname, user))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx, cancel := withTimeout(ctx, pg.Data.QueryTimeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// CommandSource connects by running a command, typically psql over ssh on
+// the postgres VM. The command fails when the connection is rejected.
+type CommandSource struct {
+	Label      string
+	SourceKind string
+	Command    func(ctx context.Context, dbname string, user User, sslmode string) *exec.Cmd
+}
+
+func (s CommandSource) Name() string { return s.Label }
+func (s CommandSource) Kind() string { return s.SourceKind }
+
+func (s CommandSource) Connect(ctx context.Context, pg PGData, dbname string, user User) error {
+	_, stderr, err := RunCommand(s.Command(ctx, dbname, user, pg.Data.SSLMode))
+	if err != nil {
+		return fmt.Errorf(CommandSourceErr, err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// PGProbeUser is a user to probe, with the credentials for every auth
+// method it should be tried with.
+type PGProbeUser struct {
+	Name        string
+	Password    string
+	Certificate string
+	Key         string
+}
+
+func (u PGProbeUser) credentials(auth string) User {
+	if auth == AuthCert {
+		return User{Name: u.Name, Certificate: u.Certificate, Key: u.Key}
+	}
+	return User{Name: u.Name, Password: u.Password}
+}
+
+// PGProbe lists the dimensions of a connectivity matrix: every user is tried
+// with every auth method and sslmode from every source.
+type PGProbe struct {
+	DBName      string
+	Users       []PGProbeUser
+	AuthMethods []string
+	SSLModes    []string
+	Sources     []PGProbeSource
+}
+
+type PGProbeCell struct {
+	User     string
+	Auth     string
+	SSLMode  string
+	Source   string
+	Accepted bool
+	Err      string
+}
+
+func (c PGProbeCell) key() string {
+	return fmt.Sprintf("%s auth=%s sslmode=%s source=%s", c.User, c.Auth, c.SSLMode, c.Source)
+}
+
+func (c PGProbeCell) String() string {
+	if c.Accepted {
+		return "ACCEPT " + c.key()
+	}
+	if c.Err == "" {
+		return "REJECT " + c.key()
+	}
+	return fmt.Sprintf("REJECT %s: %s", c.key(), c.Err)
+}
+
+// PGConnMatrix holds one cell per probed combination.
+type PGConnMatrix []PGProbeCell
+
+func (probe PGProbe) cells() PGConnMatrix {
+	var result PGConnMatrix
+	for _, user := range probe.Users {
+		for _, auth := range probe.AuthMethods {
+			for _, sslmode := range probe.SSLModes {
+				for _, source := range probe.Sources {
+					result = append(result, PGProbeCell{User: user.Name, Auth: auth, SSLMode: sslmode, Source: source.Name()})
+				}
+			}
+		}
+	}
+	return result
+}
+
+// ProbeConnectivity tries every combination in probe and records whether
+// the server accepted it. The root certificate and driver are taken from pg.
+func (pg PGData) ProbeConnectivity(ctx context.Context, probe PGProbe) PGConnMatrix {
+	dbname := probe.DBName
+	if dbname == "" {
+		dbname = DefaultDB
+	}
+	users := make(map[string]PGProbeUser)
+	for _, user := range probe.Users {
+		users[user.Name] = user
+	}
+	sources := make(map[string]PGProbeSource)
+	for _, source := range probe.Sources {
+		sources[source.Name()] = source
+	}
+	result := probe.cells()
+	for idx, cell := range result {
+		cellPG := pg
+		cellPG.Data.SSLMode = cell.SSLMode
+		err := sources[cell.Source].Connect(ctx, cellPG, dbname, users[cell.User].credentials(cell.Auth))
+		result[idx].Accepted = err == nil
+		if err != nil {
+			result[idx].Err = err.Error()
+		}
+	}
+	return result
+}
+
+// Mismatches lists the cells of expected whose outcome differs in m.
+func (m PGConnMatrix) Mismatches(expected PGConnMatrix) []string {
+	actual := make(map[string]PGProbeCell)
+	for _, cell := range m {
+		actual[cell.key()] = cell
+	}
+	var result []string
+	for _, want := range expected {
+		got, ok := actual[want.key()]
+		switch {
+		case !ok:
+			result = append(result, fmt.Sprintf("%s: not probed", want.key()))
+		case got.Accepted != want.Accepted:
+			result = append(result, fmt.Sprintf("expected %s, got %s", verdict(want.Accepted), got))
+		}
+	}
+	return result
+}
+
+func (m PGConnMatrix) String() string {
+	lines := make([]string, len(m))
+	for idx, cell := range m {
+		lines[idx] = cell.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func verdict(accepted bool) string {
+	if accepted {
+		return "ACCEPT"
+	}
+	return "REJECT"
+}
+
+// ExpectedConnectivity derives from the job properties the matrix that the
+// rendered pg_hba.conf should produce for probe: vcap is always trusted
+// locally, other local connections are trusted unless
+// databases.trust_local_connections is false, roles without a password
+// authenticate with a certificate over TLS, and everybody else uses md5.
+// Users that are neither vcap nor a role are always rejected.
+func ExpectedConnectivity(props Properties, probe PGProbe) PGConnMatrix {
+	kinds := make(map[string]string)
+	for _, source := range probe.Sources {
+		kinds[source.Name()] = source.Kind()
+	}
+	result := probe.cells()
+	for idx, cell := range result {
+		result[idx].Accepted = props.Databases.expectAccepted(cell.User, cell.Auth, cell.SSLMode, kinds[cell.Source])
+	}
+	return result
+}
+
+func (p PgProperties) expectAccepted(user string, auth string, sslmode string, kind string) bool {
+	vcap := user == "vcap"
+	var role *PgRoleProperties
+	for idx := range p.Roles {
+		if p.Roles[idx].Name == user {
+			role = &p.Roles[idx]
+		}
+	}
+	if !vcap && role == nil {
+		return false
+	}
+	trustLocal := p.TrustLocalConnections == nil || *p.TrustLocalConnections
+
+	switch kind {
+	case SourceLocal:
+		if vcap || trustLocal {
+			return true
+		}
+		return auth == AuthPassword && role.Password != ""
+	case SourceLoopback:
+		if vcap || trustLocal {
+			return true
+		}
+	}
+	if vcap {
+		return false
+	}
+
+	// The client may try a plain and a TLS connection depending on sslmode.
+	serverTLS := p.TLS.Certificate != ""
+	var attempts []bool
+	switch sslmode {
+	case "disable":
+		attempts = []bool{false}
+	case "allow":
+		attempts = []bool{false}
+		if serverTLS {
+			attempts = append(attempts, true)
+		}
+	case "prefer":
+		attempts = []bool{serverTLS}
+	default:
+		if serverTLS {
+			attempts = []bool{true}
+		}
+	}
+	for _, tls := range attempts {
+		if role.Password == "" {
+			if tls && auth == AuthCert {
+				return true
+			}
+		} else if auth == AuthPassword {
+			return true
+		}
+	}
+	return false
+}
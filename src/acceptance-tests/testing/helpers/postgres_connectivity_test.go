@@ -0,0 +1,194 @@
+package helpers_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeSource struct {
+	name   string
+	kind   string
+	accept func(pg helpers.PGData, user helpers.User) bool
+}
+
+func (s fakeSource) Name() string { return s.name }
+func (s fakeSource) Kind() string { return s.kind }
+func (s fakeSource) Connect(ctx context.Context, pg helpers.PGData, dbname string, user helpers.User) error {
+	if s.accept(pg, user) {
+		return nil
+	}
+	return errors.New("no pg_hba.conf entry")
+}
+
+var _ = Describe("Connectivity matrix", func() {
+	var (
+		props helpers.Properties
+		probe helpers.PGProbe
+	)
+
+	BeforeEach(func() {
+		trust := false
+		props = helpers.Properties{
+			Databases: helpers.PgProperties{
+				TrustLocalConnections: &trust,
+				TLS:                   helpers.PgTLS{Certificate: "cert"},
+				Roles: []helpers.PgRoleProperties{
+					{Name: "pwduser", Password: "secret"},
+					{Name: "certuser"},
+					{Name: "mappeduser", CommonName: "mapped_cn"},
+				},
+			},
+		}
+		probe = helpers.PGProbe{
+			Users: []helpers.PGProbeUser{
+				{Name: "pwduser", Password: "secret"},
+				{Name: "certuser", Certificate: "/tmp/c", Key: "/tmp/k"},
+				{Name: "vcap"},
+				{Name: "nobody", Password: "x"},
+			},
+			AuthMethods: []string{helpers.AuthPassword, helpers.AuthCert},
+			SSLModes:    []string{"disable", "allow", "prefer", "require", "verify-full"},
+			Sources: []helpers.PGProbeSource{
+				fakeSource{name: "socket", kind: helpers.SourceLocal},
+				fakeSource{name: "127.0.0.1", kind: helpers.SourceLoopback},
+				fakeSource{name: "runner", kind: helpers.SourceRemote},
+			},
+		}
+	})
+
+	accepted := func(matrix helpers.PGConnMatrix) []string {
+		var result []string
+		for _, cell := range matrix {
+			if cell.Accepted {
+				result = append(result, cell.User+" "+cell.Auth+" "+cell.SSLMode+" "+cell.Source)
+			}
+		}
+		return result
+	}
+
+	Context("Deriving the expected matrix from the properties", func() {
+		It("Only trusts vcap locally when local connections are not trusted", func() {
+			probe.SSLModes = []string{"require"}
+			expected := helpers.ExpectedConnectivity(props, probe)
+			Expect(expected).To(HaveLen(4 * 2 * 1 * 3))
+			Expect(accepted(expected)).To(ConsistOf(
+				"pwduser password require socket",
+				"pwduser password require 127.0.0.1",
+				"pwduser password require runner",
+				"certuser cert require 127.0.0.1",
+				"certuser cert require runner",
+				"vcap password require socket",
+				"vcap cert require socket",
+				"vcap password require 127.0.0.1",
+				"vcap cert require 127.0.0.1",
+			))
+		})
+
+		It("Trusts every role locally by default", func() {
+			props.Databases.TrustLocalConnections = nil
+			probe.SSLModes = []string{"disable"}
+			probe.Sources = probe.Sources[:1]
+			Expect(accepted(helpers.ExpectedConnectivity(props, probe))).To(ConsistOf(
+				"pwduser password disable socket",
+				"pwduser cert disable socket",
+				"certuser password disable socket",
+				"certuser cert disable socket",
+				"vcap password disable socket",
+				"vcap cert disable socket",
+			))
+		})
+
+		It("Accepts certificate roles remotely only when TLS is negotiated", func() {
+			probe.Users = probe.Users[1:2]
+			probe.AuthMethods = []string{helpers.AuthCert}
+			probe.Sources = probe.Sources[2:]
+			Expect(accepted(helpers.ExpectedConnectivity(props, probe))).To(ConsistOf(
+				"certuser cert allow runner",
+				"certuser cert prefer runner",
+				"certuser cert require runner",
+				"certuser cert verify-full runner",
+			))
+
+			props.Databases.TLS = helpers.PgTLS{}
+			Expect(accepted(helpers.ExpectedConnectivity(props, probe))).To(BeEmpty())
+		})
+
+		It("Rejects password roles that require TLS from a server without TLS", func() {
+			props.Databases.TLS = helpers.PgTLS{}
+			probe.Users = probe.Users[:1]
+			probe.AuthMethods = []string{helpers.AuthPassword}
+			probe.Sources = probe.Sources[2:]
+			Expect(accepted(helpers.ExpectedConnectivity(props, probe))).To(ConsistOf(
+				"pwduser password disable runner",
+				"pwduser password allow runner",
+				"pwduser password prefer runner",
+			))
+		})
+	})
+
+	Context("Probing the server", func() {
+		var pg helpers.PGData
+
+		BeforeEach(func() {
+			pg = helpers.PGData{Data: helpers.PGCommon{Address: "host", Port: 5524, SSLRootCert: "/tmp/root"}}
+			probe.Users = probe.Users[:2]
+			probe.AuthMethods = []string{helpers.AuthPassword}
+			probe.SSLModes = []string{"disable", "require"}
+			probe.Sources = []helpers.PGProbeSource{
+				fakeSource{name: "runner", kind: helpers.SourceRemote, accept: func(pg helpers.PGData, user helpers.User) bool {
+					return user.Password != "" && pg.Data.SSLMode == "require" && pg.Data.SSLRootCert == "/tmp/root"
+				}},
+			}
+		})
+
+		It("Records the outcome and the server error of every combination", func() {
+			matrix := pg.ProbeConnectivity(context.Background(), probe)
+			Expect(matrix).To(Equal(helpers.PGConnMatrix{
+				{User: "pwduser", Auth: "password", SSLMode: "disable", Source: "runner", Err: "no pg_hba.conf entry"},
+				{User: "pwduser", Auth: "password", SSLMode: "require", Source: "runner", Accepted: true},
+				{User: "certuser", Auth: "password", SSLMode: "disable", Source: "runner", Err: "no pg_hba.conf entry"},
+				{User: "certuser", Auth: "password", SSLMode: "require", Source: "runner", Err: "no pg_hba.conf entry"},
+			}))
+			Expect(pg.Data.SSLMode).To(BeEmpty())
+			Expect(matrix.String()).To(ContainSubstring("ACCEPT pwduser auth=password sslmode=require source=runner"))
+		})
+
+		It("Reports the cells that differ from the expected matrix", func() {
+			matrix := pg.ProbeConnectivity(context.Background(), probe)
+			expected := helpers.ExpectedConnectivity(props, probe)
+			Expect(matrix.Mismatches(expected)).To(ConsistOf(
+				"expected ACCEPT, got REJECT pwduser auth=password sslmode=disable source=runner: no pg_hba.conf entry",
+			))
+			Expect(matrix[:1].Mismatches(expected)).To(ContainElement("certuser auth=password sslmode=require source=runner: not probed"))
+		})
+	})
+
+	Context("Connecting by running a command", func() {
+		It("Reports the command error output when the connection is rejected", func() {
+			source := helpers.CommandSource{
+				Label:      "ssh",
+				SourceKind: helpers.SourceLocal,
+				Command: func(ctx context.Context, dbname string, user helpers.User, sslmode string) *exec.Cmd {
+					return exec.CommandContext(ctx, "sh", "-c", `echo "FATAL: role \"$0\" does not exist" >&2; exit 2`, user.Name)
+				},
+			}
+			err := source.Connect(context.Background(), helpers.PGData{}, "postgres", helpers.User{Name: "nobody"})
+			Expect(err).To(MatchError(ContainSubstring(`FATAL: role "nobody" does not exist`)))
+		})
+
+		It("Accepts the connection when the command succeeds", func() {
+			source := helpers.CommandSource{
+				Command: func(ctx context.Context, dbname string, user helpers.User, sslmode string) *exec.Cmd {
+					return exec.CommandContext(ctx, "true")
+				},
+			}
+			Expect(source.Connect(context.Background(), helpers.PGData{}, "postgres", helpers.User{})).To(Succeed())
+		})
+	})
+})
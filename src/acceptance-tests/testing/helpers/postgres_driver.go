@@ -0,0 +1,149 @@
+package helpers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/lib/pq"
+)
+
+const (
+	LibPQDriver = "lib/pq"
+	PGXDriver   = "pgx"
+)
+
+const UnknownDriverErr = "Unknown postgres driver %q: use %q or %q"
+const UnsupportedConnParamErr = "Connection parameter %s is not supported by the %s driver"
+const ForeignDriverConnErr = "Connection %T was not opened by the %s driver"
+
+// PGDriver opens connections and bulk loads tables through a specific
+// PostgreSQL driver, so the same specs can run against each of them.
+type PGDriver interface {
+	Name() string
+	Open(params PGConnParams) (*sql.DB, error)
+	CopyIn(ctx context.Context, db *sql.DB, table PGLoadTable) error
+}
+
+var drivers = map[string]PGDriver{
+	LibPQDriver: libpqDriver{},
+	PGXDriver:   pgxDriver{},
+}
+
+// GetDriver returns the driver registered as name; an empty name selects
+// lib/pq.
+func GetDriver(name string) (PGDriver, error) {
+	if name == "" {
+		name = LibPQDriver
+	}
+	driver, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf(UnknownDriverErr, name, LibPQDriver, PGXDriver)
+	}
+	return driver, nil
+}
+
+// SQLState returns the SQLSTATE code of an error the server raised, through
+// either driver, and "" for any other error.
+func SQLState(err error) string {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState()
+	}
+	return ""
+}
+
+type libpqDriver struct{}
+
+func (libpqDriver) Name() string { return LibPQDriver }
+
+func (d libpqDriver) Open(params PGConnParams) (*sql.DB, error) {
+	// lib/pq forwards the parameters it does not know to the server as
+	// runtime settings, which the server then rejects.
+	unsupported := map[string]string{
+		"sslpassword":     params.SSLPassword,
+		"sslcrl":          params.SSLCRL,
+		"channel_binding": params.ChannelBinding,
+	}
+	for _, key := range []string{"sslpassword", "sslcrl", "channel_binding"} {
+		if unsupported[key] != "" {
+			return nil, fmt.Errorf(UnsupportedConnParamErr, key, d.Name())
+		}
+	}
+	return sql.Open("postgres", params.String())
+}
+
+// CopyIn streams the rows of table through a COPY FROM STDIN statement,
+// which lib/pq exposes as a prepared statement.
+func (libpqDriver) CopyIn(ctx context.Context, db *sql.DB, table PGLoadTable) error {
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	stmt, err := txn.PrepareContext(ctx, table.PrepareStatement())
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < table.NumRows; i++ {
+		_, err = stmt.ExecContext(ctx, table.PrepareRow(i)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+type pgxDriver struct{}
+
+func (pgxDriver) Name() string { return PGXDriver }
+
+func (d pgxDriver) Open(params PGConnParams) (*sql.DB, error) {
+	if params.SSLCRL != "" {
+		return nil, fmt.Errorf(UnsupportedConnParamErr, "sslcrl", d.Name())
+	}
+	config, err := pgx.ParseConfig(params.String())
+	if err != nil {
+		return nil, err
+	}
+	return stdlib.OpenDB(*config), nil
+}
+
+// CopyIn uses the COPY protocol support of pgx on a connection taken from
+// the pool.
+func (pgxDriver) CopyIn(ctx context.Context, db *sql.DB, table PGLoadTable) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf(ForeignDriverConnErr, driverConn, PGXDriver)
+		}
+		pgxConn := stdlibConn.Conn()
+		rows := pgx.CopyFromSlice(table.NumRows, func(i int) ([]interface{}, error) {
+			return table.PrepareRow(i), nil
+		})
+		_, err := pgxConn.CopyFrom(ctx, pgx.Identifier{table.Name}, table.ColumnNames, rows)
+		return err
+	})
+}
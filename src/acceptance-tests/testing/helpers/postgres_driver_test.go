@@ -0,0 +1,95 @@
+package helpers_test
+
+import (
+	"context"
+	"fmt"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Postgres drivers", func() {
+	params := helpers.PGConnParams{Host: "localhost", Port: 5432, DBName: "db", User: "u", Password: "p w", SSLMode: "disable"}
+
+	It("Selects lib/pq by default", func() {
+		driver, err := helpers.GetDriver("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(driver.Name()).To(Equal(helpers.LibPQDriver))
+	})
+
+	It("Fails to select an unknown driver", func() {
+		_, err := helpers.GetDriver("odbc")
+		Expect(err).To(MatchError(ContainSubstring(`Unknown postgres driver "odbc"`)))
+		_, err = helpers.NewPostgres(helpers.PGCommon{
+			Address: "xx",
+			Port:    10,
+			Driver:  "odbc",
+			DefUser: helpers.User{Name: "uu", Password: "pp"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("Opening pools without connecting",
+		func(name string, params helpers.PGConnParams, expectedErr string) {
+			driver, err := helpers.GetDriver(name)
+			Expect(err).NotTo(HaveOccurred())
+			db, err := driver.Open(params)
+			if expectedErr != "" {
+				Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(db.Close()).To(Succeed())
+		},
+		Entry("lib/pq", helpers.LibPQDriver, params, ""),
+		Entry("pgx", helpers.PGXDriver, params, ""),
+		Entry("pgx with direct TLS and channel binding", helpers.PGXDriver,
+			helpers.PGConnParams{Host: "localhost", DBName: "db", SSLMode: "require", SSLNegotiation: "direct", ChannelBinding: "require"}, ""),
+		Entry("lib/pq with channel binding", helpers.LibPQDriver,
+			helpers.PGConnParams{DBName: "db", ChannelBinding: "require"}, "channel_binding is not supported by the lib/pq driver"),
+		Entry("lib/pq with a key password", helpers.LibPQDriver,
+			helpers.PGConnParams{DBName: "db", SSLPassword: "secret"}, "sslpassword is not supported by the lib/pq driver"),
+		Entry("pgx with a CRL", helpers.PGXDriver,
+			helpers.PGConnParams{DBName: "db", SSLCRL: "/tmp/crl"}, "sslcrl is not supported by the pgx driver"),
+		Entry("pgx with an invalid parameter", helpers.PGXDriver,
+			helpers.PGConnParams{DBName: "db", TargetSessionAttrs: "bogus"}, "target_session_attrs"),
+	)
+
+	It("Refuses to bulk load through a connection of another driver", func() {
+		db, _, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		driver, err := helpers.GetDriver(helpers.PGXDriver)
+		Expect(err).NotTo(HaveOccurred())
+
+		table := helpers.GetSampleLoadWithPrefix(helpers.Test1Load, "pgats_table")[0]
+		err = driver.CopyIn(context.Background(), db, table)
+		Expect(err).To(MatchError(ContainSubstring("was not opened by the pgx driver")))
+	})
+
+	It("Keeps pools opened by different drivers apart", func() {
+		user := helpers.User{Name: "u", Password: "p"}
+		pg := helpers.PGData{Data: helpers.PGCommon{SSLMode: "disable"}, Conns: helpers.NewPGConnRegistry()}
+		defer pg.CloseConnections()
+		db, _, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		pg.AddConnection("db1", user, db)
+
+		pg.Data.Driver = helpers.PGXDriver
+		_, err = pg.GetDBConnectionForUser("db1", user)
+		Expect(err).To(MatchError(helpers.NoConnectionAvailableErr))
+		conn := pg.AddConnection("db1", user, db)
+		Expect(conn.Driver).To(Equal(helpers.PGXDriver))
+		Expect(pg.Conns.Len()).To(Equal(2))
+	})
+	It("Reads the SQLSTATE of errors from either driver", func() {
+		Expect(helpers.SQLState(&pq.Error{Code: "XX002"})).To(Equal("XX002"))
+		Expect(helpers.SQLState(fmt.Errorf("checking: %w", &pgconn.PgError{Code: "42P01"}))).To(Equal("42P01"))
+		Expect(helpers.SQLState(genericError)).To(BeEmpty())
+	})
+})
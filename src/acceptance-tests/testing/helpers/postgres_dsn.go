@@ -0,0 +1,89 @@
+package helpers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PGConnParams holds the libpq connection parameters used to open a
+// connection. String renders them as a key/value connection string quoted
+// as described in
+// https://www.postgresql.org/docs/current/libpq-connect.html#LIBPQ-CONNSTRING
+type PGConnParams struct {
+	Host               string
+	Port               int
+	DBName             string
+	User               string
+	Password           string
+	SSLMode            string
+	SSLNegotiation     string
+	SSLRootCert        string
+	SSLCert            string
+	SSLKey             string
+	SSLPassword        string
+	SSLCRL             string
+	ChannelBinding     string
+	ConnectTimeout     time.Duration
+	ApplicationName    string
+	TargetSessionAttrs string
+	Options            string
+}
+
+type connParam struct {
+	key   string
+	value string
+}
+
+func (p PGConnParams) params() []connParam {
+	var port, timeout string
+	if p.Port != 0 {
+		port = strconv.Itoa(p.Port)
+	}
+	if p.ConnectTimeout > 0 {
+		// libpq only takes whole seconds; round up so a short timeout
+		// does not turn into "wait forever".
+		timeout = strconv.FormatInt(int64((p.ConnectTimeout+time.Second-1)/time.Second), 10)
+	}
+	return []connParam{
+		{"dbname", p.DBName},
+		{"user", p.User},
+		{"host", p.Host},
+		{"port", port},
+		{"sslmode", p.SSLMode},
+		{"sslnegotiation", p.SSLNegotiation},
+		{"sslrootcert", p.SSLRootCert},
+		{"sslcert", p.SSLCert},
+		{"sslkey", p.SSLKey},
+		{"sslpassword", p.SSLPassword},
+		{"sslcrl", p.SSLCRL},
+		{"channel_binding", p.ChannelBinding},
+		{"password", p.Password},
+		{"connect_timeout", timeout},
+		{"application_name", p.ApplicationName},
+		{"target_session_attrs", p.TargetSessionAttrs},
+		{"options", p.Options},
+	}
+}
+
+// String returns the connection string; empty parameters are left out.
+func (p PGConnParams) String() string {
+	var result []string
+	for _, param := range p.params() {
+		if param.value != "" {
+			result = append(result, param.key+"="+QuoteConnValue(param.value))
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+// QuoteConnValue quotes value for a key/value connection string. Values
+// that are empty or contain whitespace, single quotes or backslashes are
+// wrapped in single quotes, with quotes and backslashes escaped.
+func QuoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\r\f\v'\\") {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + replacer.Replace(value) + "'"
+}
@@ -0,0 +1,98 @@
+package helpers_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+	"github.com/lib/pq"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection strings", func() {
+	DescribeTable("Quoting values",
+		func(value string, expected string) {
+			Expect(helpers.QuoteConnValue(value)).To(Equal(expected))
+		},
+		Entry("plain value", "sandbox", "sandbox"),
+		Entry("shell characters", "adm$in!", "adm$in!"),
+		Entry("equal sign", "a=b", "a=b"),
+		Entry("empty value", "", "''"),
+		Entry("space", "my password", "'my password'"),
+		Entry("tab and newline", "a\tb\nc", "'a\tb\nc'"),
+		Entry("single quote", "it's", `'it\'s'`),
+		Entry("backslash", `a\b`, `'a\\b'`),
+		Entry("double quote", `say"hi"`, `say"hi"`),
+	)
+
+	DescribeTable("Rendering parameters",
+		func(params helpers.PGConnParams, expected string) {
+			Expect(params.String()).To(Equal(expected))
+		},
+		Entry("minimal", helpers.PGConnParams{DBName: "postgres", User: "u", Host: "10.0.0.1", Port: 5432},
+			"dbname=postgres user=u host=10.0.0.1 port=5432"),
+		Entry("password with spaces and quotes", helpers.PGConnParams{DBName: "db", User: "u", Password: `p 'w' \d`},
+			`dbname=db user=u password='p \'w\' \\d'`),
+		Entry("certificate authentication", helpers.PGConnParams{
+			DBName: "db", User: "u", SSLMode: "verify-full", SSLRootCert: "/tmp/root ca", SSLCert: "/tmp/c", SSLKey: "/tmp/k", SSLPassword: "secret", SSLCRL: "/tmp/crl",
+		}, "dbname=db user=u sslmode=verify-full sslrootcert='/tmp/root ca' sslcert=/tmp/c sslkey=/tmp/k sslpassword=secret sslcrl=/tmp/crl"),
+		Entry("session parameters", helpers.PGConnParams{
+			DBName: "db", SSLNegotiation: "direct", ConnectTimeout: 10 * time.Second, ApplicationName: "pg ats", TargetSessionAttrs: "read-write", Options: "-c search_path=a,b -c statement_timeout=5s",
+		}, "dbname=db sslnegotiation=direct connect_timeout=10 application_name='pg ats' target_session_attrs=read-write options='-c search_path=a,b -c statement_timeout=5s'"),
+		Entry("sub-second connect timeout", helpers.PGConnParams{DBName: "db", ConnectTimeout: 1500 * time.Millisecond},
+			"dbname=db connect_timeout=2"),
+	)
+
+	DescribeTable("Parsing back with lib/pq",
+		func(password string) {
+			params := helpers.PGConnParams{DBName: "my db", User: "o'brien", Host: "localhost", Port: 5524, SSLMode: "disable", Password: password, ApplicationName: "pg ats"}
+			cfg, err := pq.NewConfig(params.String())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Password).To(Equal(password))
+			Expect(cfg.Database).To(Equal("my db"))
+			Expect(cfg.User).To(Equal("o'brien"))
+			Expect(cfg.ApplicationName).To(Equal("pg ats"))
+		},
+		Entry("default test password", "adm$in!"),
+		Entry("spaces", "with some spaces"),
+		Entry("quotes", `'"quoted"'`),
+		Entry("backslashes", `\\server\share\`),
+		Entry("key/value lookalike", "x host=evil"),
+	)
+
+	Context("Building parameters from PGData", func() {
+		var pg helpers.PGData
+
+		BeforeEach(func() {
+			pg = helpers.PGData{
+				Data: helpers.PGCommon{
+					Address:         "1.1.1.1",
+					Port:            5524,
+					SSLMode:         "verify-full",
+					SSLRootCert:     "/tmp/root",
+					ApplicationName: "pgats",
+					ConnectTimeout:  5 * time.Second,
+				},
+			}
+		})
+
+		It("Uses the password of password users", func() {
+			params := pg.ConnectionParams("db", helpers.User{Name: "u", Password: "p w"})
+			Expect(params.String()).To(Equal("dbname=db user=u host=1.1.1.1 port=5524 sslmode=verify-full sslrootcert=/tmp/root password='p w' connect_timeout=5 application_name=pgats"))
+		})
+
+		It("Uses the certificate of certificate users", func() {
+			params := pg.ConnectionParams("db", helpers.User{Name: "u", Certificate: "/tmp/c", Key: "/tmp/k"})
+			Expect(params.Password).To(BeEmpty())
+			Expect(params.SSLCert).To(Equal("/tmp/c"))
+			Expect(params.SSLKey).To(Equal("/tmp/k"))
+		})
+
+		It("Refuses parameters the driver would send to the server", func() {
+			pg.Data.SSLCRL = "/tmp/crl"
+			_, err := pg.OpenConnection("db", helpers.User{Name: "u", Password: "p"})
+			Expect(err).To(MatchError(ContainSubstring("sslcrl is not supported")))
+		})
+	})
+})
@@ -0,0 +1,151 @@
+package helpers
+
+import (
+	"context"
+	"sort"
+)
+
+// The ACL queries expand the access privileges of each object with
+// aclexplode, using the built-in defaults when no GRANT or REVOKE was ever
+// run on it. PUBLIC is reported as the grantee "PUBLIC".
+const ListDatabasePrivilegesQuery = "SELECT d.datname AS database, pg_get_userbyid(d.datdba) AS owner, coalesce(r.rolname, 'PUBLIC') AS grantee, a.privilege_type AS privilege, a.is_grantable AS grantable FROM pg_database d CROSS JOIN LATERAL aclexplode(coalesce(d.datacl, acldefault('d', d.datdba))) a LEFT JOIN pg_roles r ON r.oid = a.grantee WHERE NOT d.datistemplate ORDER BY 1, 3, 4"
+const ListSchemaPrivilegesQuery = "SELECT n.nspname AS schema, pg_get_userbyid(n.nspowner) AS owner, coalesce(r.rolname, 'PUBLIC') AS grantee, a.privilege_type AS privilege, a.is_grantable AS grantable FROM pg_namespace n CROSS JOIN LATERAL aclexplode(coalesce(n.nspacl, acldefault('n', n.nspowner))) a LEFT JOIN pg_roles r ON r.oid = a.grantee WHERE n.nspname NOT LIKE 'pg\\_%' AND n.nspname != 'information_schema' ORDER BY 1, 3, 4"
+const ListTablePrivilegesQuery = "SELECT n.nspname AS schema, c.relname AS tablename, pg_get_userbyid(c.relowner) AS owner, coalesce(r.rolname, 'PUBLIC') AS grantee, a.privilege_type AS privilege, a.is_grantable AS grantable FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace CROSS JOIN LATERAL aclexplode(coalesce(c.relacl, acldefault('r', c.relowner))) a LEFT JOIN pg_roles r ON r.oid = a.grantee WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f') AND n.nspname NOT LIKE 'pg\\_%' AND n.nspname != 'information_schema' ORDER BY 1, 2, 4, 5"
+const ListRoleMembershipsQuery = "SELECT r.rolname AS role, m.rolname AS member, am.admin_option FROM pg_auth_members am JOIN pg_roles r ON r.oid = am.roleid JOIN pg_roles m ON m.oid = am.member ORDER BY 1, 2"
+
+const PublicGrantee = "PUBLIC"
+
+type PGDatabasePrivilege struct {
+	Database  string `db:"database"`
+	Owner     string `db:"owner"`
+	Grantee   string `db:"grantee"`
+	Privilege string `db:"privilege"`
+	Grantable bool   `db:"grantable"`
+}
+
+type PGSchemaPrivilege struct {
+	// Database is not read from the catalog but filled in by GetGrants.
+	Database  string
+	Schema    string `db:"schema"`
+	Owner     string `db:"owner"`
+	Grantee   string `db:"grantee"`
+	Privilege string `db:"privilege"`
+	Grantable bool   `db:"grantable"`
+}
+
+type PGTablePrivilege struct {
+	// Database is not read from the catalog but filled in by GetGrants.
+	Database  string
+	Schema    string `db:"schema"`
+	Table     string `db:"tablename"`
+	Owner     string `db:"owner"`
+	Grantee   string `db:"grantee"`
+	Privilege string `db:"privilege"`
+	Grantable bool   `db:"grantable"`
+}
+
+type PGRoleMembership struct {
+	Role        string `db:"role"`
+	Member      string `db:"member"`
+	AdminOption bool   `db:"admin_option"`
+}
+
+// PGGrants is every privilege granted on the databases, and on the schemas
+// and tables of the databases it was read from, plus the role memberships.
+type PGGrants struct {
+	Databases   []PGDatabasePrivilege
+	Schemas     []PGSchemaPrivilege
+	Tables      []PGTablePrivilege
+	Memberships []PGRoleMembership
+}
+
+func (pg PGData) ListDatabasePrivileges() ([]PGDatabasePrivilege, error) {
+	return pg.ListDatabasePrivilegesContext(context.Background())
+}
+func (pg PGData) ListDatabasePrivilegesContext(ctx context.Context) ([]PGDatabasePrivilege, error) {
+	conn, err := pg.GetSuperUserConnectionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Query[PGDatabasePrivilege](ctx, conn, ListDatabasePrivilegesQuery)
+}
+
+func (pg PGData) ListSchemaPrivileges(dbName string) ([]PGSchemaPrivilege, error) {
+	return pg.ListSchemaPrivilegesContext(context.Background(), dbName)
+}
+func (pg PGData) ListSchemaPrivilegesContext(ctx context.Context, dbName string) ([]PGSchemaPrivilege, error) {
+	conn, err := pg.GetDBSuperUserConnectionContext(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	result, err := Query[PGSchemaPrivilege](ctx, conn, ListSchemaPrivilegesQuery)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range result {
+		result[idx].Database = dbName
+	}
+	return result, nil
+}
+
+func (pg PGData) ListTablePrivileges(dbName string) ([]PGTablePrivilege, error) {
+	return pg.ListTablePrivilegesContext(context.Background(), dbName)
+}
+func (pg PGData) ListTablePrivilegesContext(ctx context.Context, dbName string) ([]PGTablePrivilege, error) {
+	conn, err := pg.GetDBSuperUserConnectionContext(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+	result, err := Query[PGTablePrivilege](ctx, conn, ListTablePrivilegesQuery)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range result {
+		result[idx].Database = dbName
+	}
+	return result, nil
+}
+
+func (pg PGData) ListRoleMemberships() ([]PGRoleMembership, error) {
+	return pg.ListRoleMembershipsContext(context.Background())
+}
+func (pg PGData) ListRoleMembershipsContext(ctx context.Context) ([]PGRoleMembership, error) {
+	conn, err := pg.GetSuperUserConnectionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Query[PGRoleMembership](ctx, conn, ListRoleMembershipsQuery)
+}
+
+// GetGrants reads the database privileges and role memberships of the
+// cluster, and the schema and table privileges of dbNames.
+func (pg PGData) GetGrants(dbNames ...string) (PGGrants, error) {
+	return pg.GetGrantsContext(context.Background(), dbNames...)
+}
+func (pg PGData) GetGrantsContext(ctx context.Context, dbNames ...string) (PGGrants, error) {
+	var result PGGrants
+	var err error
+	result.Databases, err = pg.ListDatabasePrivilegesContext(ctx)
+	if err != nil {
+		return PGGrants{}, err
+	}
+	result.Memberships, err = pg.ListRoleMembershipsContext(ctx)
+	if err != nil {
+		return PGGrants{}, err
+	}
+	sorted := append([]string{}, dbNames...)
+	sort.Strings(sorted)
+	for _, dbName := range sorted {
+		schemas, err := pg.ListSchemaPrivilegesContext(ctx, dbName)
+		if err != nil {
+			return PGGrants{}, err
+		}
+		result.Schemas = append(result.Schemas, schemas...)
+		tables, err := pg.ListTablePrivilegesContext(ctx, dbName)
+		if err != nil {
+			return PGGrants{}, err
+		}
+		result.Tables = append(result.Tables, tables...)
+	}
+	return result, nil
+}
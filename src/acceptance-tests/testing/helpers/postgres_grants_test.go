@@ -0,0 +1,65 @@
+package helpers_test
+
+import (
+	"context"
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Grants", func() {
+	var (
+		pg    helpers.PGData
+		mocks map[string]sqlmock.Sqlmock
+	)
+
+	BeforeEach(func() {
+		pg, mocks = mockSuperUserConnections(helpers.DefaultDB, "db1")
+	})
+
+	It("Reads the ACLs of the databases, schemas and tables and the role memberships", func() {
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.ListDatabasePrivilegesQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"database", "owner", "grantee", "privilege", "grantable"}).
+				AddRow("db1", "vcap", "PUBLIC", "CONNECT", false).
+				AddRow("db1", "vcap", "vcap", "CREATE", false))
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.ListRoleMembershipsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"role", "member", "admin_option"}).AddRow("pg_monitor", "pgadmin", false))
+		mocks["db1"].ExpectQuery(regexp.QuoteMeta(helpers.ListSchemaPrivilegesQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"schema", "owner", "grantee", "privilege", "grantable"}).
+				AddRow("public", "pg_database_owner", "pgadmin", "USAGE", false))
+		mocks["db1"].ExpectQuery(regexp.QuoteMeta(helpers.ListTablePrivilegesQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"schema", "tablename", "owner", "grantee", "privilege", "grantable"}).
+				AddRow("public", "t1", "pgadmin", "pgadmin", "SELECT", true))
+
+		grants, err := pg.GetGrantsContext(context.Background(), "db1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(grants).To(Equal(helpers.PGGrants{
+			Databases: []helpers.PGDatabasePrivilege{
+				{Database: "db1", Owner: "vcap", Grantee: "PUBLIC", Privilege: "CONNECT"},
+				{Database: "db1", Owner: "vcap", Grantee: "vcap", Privilege: "CREATE"},
+			},
+			Schemas: []helpers.PGSchemaPrivilege{
+				{Database: "db1", Schema: "public", Owner: "pg_database_owner", Grantee: "pgadmin", Privilege: "USAGE"},
+			},
+			Tables: []helpers.PGTablePrivilege{
+				{Database: "db1", Schema: "public", Table: "t1", Owner: "pgadmin", Grantee: "pgadmin", Privilege: "SELECT", Grantable: true},
+			},
+			Memberships: []helpers.PGRoleMembership{{Role: "pg_monitor", Member: "pgadmin"}},
+		}))
+	})
+
+	It("Fails if a database cannot be read", func() {
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.ListDatabasePrivilegesQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"database", "owner", "grantee", "privilege", "grantable"}))
+		mocks[helpers.DefaultDB].ExpectQuery(regexp.QuoteMeta(helpers.ListRoleMembershipsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"role", "member", "admin_option"}))
+		mocks["db1"].ExpectQuery(regexp.QuoteMeta(helpers.ListSchemaPrivilegesQuery)).WillReturnError(genericError)
+
+		_, err := pg.GetGrantsContext(context.Background(), "db1")
+		Expect(err).To(MatchError(genericError))
+	})
+})
@@ -59,7 +59,7 @@ func GetSampleLoadWithPrefix(loadType LoadType, prefix string) []PGLoadTable {
 	return result
 }
 
-func (table PGLoadTable) PrepareCreate() string {
+func (table PGLoadTable) PrepareCreate() (string, error) {
 	columns := make([]string, len(table.ColumnNames))
 	for idx, name := range table.ColumnNames {
 		var dataType string
@@ -68,13 +68,33 @@ func (table PGLoadTable) PrepareCreate() string {
 		} else {
 			dataType = table.ColumnTypes[idx]
 		}
-		columns[idx] = fmt.Sprintf("%s %s", name, dataType)
+		column, err := QuoteIdentifier(name)
+		if err != nil {
+			return "", err
+		}
+		columns[idx] = fmt.Sprintf("%s %s", column, dataType)
+	}
+	name, err := QuoteIdentifier(table.Name)
+	if err != nil {
+		return "", err
 	}
-	return fmt.Sprintf("CREATE TABLE %s (%s);", table.Name, strings.Join(columns, ",\n"))
+	return fmt.Sprintf("CREATE TABLE %s (%s);", name, strings.Join(columns, ",\n")), nil
 }
 
-func (table PGLoadTable) PrepareCreateIndex() string {
-	return fmt.Sprintf("CREATE INDEX %s_index ON %s USING hash (%s) ;", table.Name, table.Name, table.ColumnNames[0])
+func (table PGLoadTable) PrepareCreateIndex() (string, error) {
+	index, err := QuoteIdentifier(table.Name + "_index")
+	if err != nil {
+		return "", err
+	}
+	name, err := QuoteIdentifier(table.Name)
+	if err != nil {
+		return "", err
+	}
+	column, err := QuoteIdentifier(table.ColumnNames[0])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("CREATE INDEX %s ON %s USING hash (%s) ;", index, name, column), nil
 }
 
 func (table PGLoadTable) PrepareStatement() string {
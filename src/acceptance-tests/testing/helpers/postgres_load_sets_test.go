@@ -86,15 +86,21 @@ var _ = Describe("Postgres load sets", func() {
 		})
 
 		It("Corretly prepare CREATE", func() {
-			expected := `CREATE TABLE test1 (column1 character varying not null,
-column2 integer,
-column3 notmanaged);`
+			expected := `CREATE TABLE "test1" ("column1" character varying not null,
+"column2" integer,
+"column3" notmanaged);`
 			Expect(table.PrepareCreate()).To(Equal(expected))
 		})
 		It("Corretly prepare statement", func() {
 			expected := `COPY "test1" ("column1", "column2", "column3") FROM STDIN`
 			Expect(table.PrepareStatement()).To(Equal(expected))
 		})
+		It("Quotes mixed-case names in CREATE and CREATE INDEX", func() {
+			table.Name = "Load_Table"
+			table.ColumnNames[0] = "Column One"
+			Expect(table.PrepareCreate()).To(HavePrefix(`CREATE TABLE "Load_Table" ("Column One" character varying not null,`))
+			Expect(table.PrepareCreateIndex()).To(Equal(`CREATE INDEX "Load_Table_index" ON "Load_Table" USING hash ("Column One") ;`))
+		})
 		It("Corretly prepare row", func() {
 			idx := 2
 			expected := []interface{}{"sample2", 2, false}
@@ -109,7 +115,7 @@ column3 notmanaged);`
 		})
 
 		It("Corretly prepare CREATE", func() {
-			expected := `CREATE TABLE test1 ();`
+			expected := `CREATE TABLE "test1" ();`
 			Expect(table.PrepareCreate()).To(Equal(expected))
 		})
 		It("Corretly prepare statement", func() {
@@ -135,8 +141,8 @@ column3 notmanaged);`
 					"character varying not null",
 				},
 			}
-			expected := `CREATE TABLE test1 (column1 character varying not null,
-column2 character varying);`
+			expected := `CREATE TABLE "test1" ("column1" character varying not null,
+"column2" character varying);`
 			Expect(table.PrepareCreate()).To(Equal(expected))
 		})
 		It("Returns empty prepared statement if table name is missing", func() {
@@ -0,0 +1,74 @@
+package helpers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+)
+
+// ListPasswordMethodsQuery reads how each password is stored from the prefix
+// of pg_authid.rolpassword, without fetching the hashes themselves.
+const ListPasswordMethodsQuery = "SELECT rolname, CASE WHEN rolpassword IS NULL THEN '' WHEN rolpassword LIKE 'SCRAM-SHA-256$%' THEN 'scram-sha-256' WHEN rolpassword LIKE 'md5%' THEN 'md5' ELSE 'plain' END AS method FROM pg_authid ORDER BY rolname"
+const CreateRoleWithPasswordQuery = "CREATE ROLE %s WITH LOGIN PASSWORD %s"
+
+const (
+	PasswordMethodNone  = ""
+	PasswordMethodMD5   = "md5"
+	PasswordMethodSCRAM = "scram-sha-256"
+	PasswordMethodPlain = "plain"
+)
+
+type PGPasswordMethod struct {
+	Role   string `db:"rolname"`
+	Method string `db:"method"`
+}
+
+// ListPasswordMethods returns how the password of every role is stored,
+// PasswordMethodNone for roles without a password.
+func (pg PGData) ListPasswordMethods() (map[string]string, error) {
+	return pg.ListPasswordMethodsContext(context.Background())
+}
+func (pg PGData) ListPasswordMethodsContext(ctx context.Context) (map[string]string, error) {
+	conn, err := pg.GetSuperUserConnectionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for row, err := range QueryRows[PGPasswordMethod](ctx, conn, ListPasswordMethodsQuery) {
+		if err != nil {
+			return nil, err
+		}
+		result[row.Role] = row.Method
+	}
+	return result, nil
+}
+
+// MD5PasswordHash returns the md5 hash PostgreSQL stores for the password of
+// user.
+func MD5PasswordHash(user string, password string) string {
+	sum := md5.Sum([]byte(password + user))
+	return PasswordMethodMD5 + hex.EncodeToString(sum[:])
+}
+
+// CreateMD5Role creates a login role whose password is stored as md5 whatever
+// password_encryption is, as it would be on a cluster initialized before
+// PostgreSQL 14.
+func (pg PGData) CreateMD5Role(name string, password string) error {
+	return pg.CreateMD5RoleContext(context.Background(), name, password)
+}
+func (pg PGData) CreateMD5RoleContext(ctx context.Context, name string, password string) error {
+	conn, err := pg.GetSuperUserConnectionContext(ctx)
+	if err != nil {
+		return err
+	}
+	role, err := QuoteIdentifier(name)
+	if err != nil {
+		return err
+	}
+	hash, err := QuoteLiteral(MD5PasswordHash(name, password))
+	if err != nil {
+		return err
+	}
+	return conn.ExecContext(ctx, fmt.Sprintf(CreateRoleWithPasswordQuery, role, hash))
+}
@@ -0,0 +1,65 @@
+package helpers_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Password storage", func() {
+	var (
+		pg   helpers.PGData
+		mock sqlmock.Sqlmock
+	)
+
+	BeforeEach(func() {
+		var mocks map[string]sqlmock.Sqlmock
+		pg, mocks = mockSuperUserConnections(helpers.DefaultDB)
+		mock = mocks[helpers.DefaultDB]
+	})
+
+	It("Hashes passwords the way PostgreSQL does with md5", func() {
+		Expect(helpers.MD5PasswordHash("md5user", "md5password")).To(Equal("md547096050c2d2a64ce5f1abb9b5af6236"))
+	})
+
+	It("Reads how every password is stored", func() {
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.ListPasswordMethodsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"rolname", "method"}).
+				AddRow("certuser", "").
+				AddRow("md5user", "md5").
+				AddRow("pgadmin", "scram-sha-256"))
+		methods, err := pg.ListPasswordMethodsContext(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(methods).To(Equal(map[string]string{
+			"certuser": helpers.PasswordMethodNone,
+			"md5user":  helpers.PasswordMethodMD5,
+			"pgadmin":  helpers.PasswordMethodSCRAM,
+		}))
+	})
+
+	It("Fails if pg_authid cannot be read", func() {
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.ListPasswordMethodsQuery)).WillReturnError(genericError)
+		_, err := pg.ListPasswordMethodsContext(context.Background())
+		Expect(err).To(MatchError(genericError))
+	})
+
+	It("Creates a role with an md5 password", func() {
+		mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(helpers.CreateRoleWithPasswordQuery, `"md5user"`, "'md547096050c2d2a64ce5f1abb9b5af6236'"))).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		Expect(pg.CreateMD5RoleContext(context.Background(), "md5user", "md5password")).To(Succeed())
+	})
+
+	It("Quotes literals", func() {
+		Expect(helpers.QuoteLiteral("md5abc")).To(Equal(`'md5abc'`))
+		Expect(helpers.QuoteLiteral("o'brien")).To(Equal(`'o''brien'`))
+		Expect(helpers.QuoteLiteral(`back\slash'`)).To(Equal(` E'back\\slash'''`))
+		_, err := helpers.QuoteLiteral("trunc\x00ated")
+		Expect(err).To(MatchError(fmt.Sprintf(helpers.InvalidLiteralErr, "trunc\x00ated")))
+	})
+})
@@ -0,0 +1,289 @@
+package helpers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const NoRowsReturnedErr = "Query returned no rows"
+const ScanColumnCountErr = "Query returned %d columns, expected 1 to scan into %s"
+const ScanColumnErr = "Cannot scan column %s: %v"
+const ScanTypeErr = "cannot convert %T to %s"
+
+// PostgresTimeFormat matches the way PostgreSQL renders timestamptz values
+// in JSON, so typed and JSON results compare equal.
+const PostgresTimeFormat = "2006-01-02T15:04:05.999999-07:00"
+
+// QueryRows runs query on conn and streams each row scanned into a T.
+// Struct fields are matched to columns by their `db` tag, falling back to
+// the `json` tag; untagged fields and unmatched columns are ignored. A T
+// that is not a struct is scanned from a single column. The iteration stops
+// at the first query or scan error, which is yielded with a zero T.
+func QueryRows[T any](ctx context.Context, conn PGConn, query string, args ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		ctx, cancel := withTimeout(ctx, conn.Timeout)
+		defer cancel()
+		rows, err := conn.DB.QueryContext(ctx, query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+		scanner, err := newRowScanner(reflect.TypeOf(zero), rows)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for rows.Next() {
+			var out T
+			if err := scanner.scan(rows, reflect.ValueOf(&out).Elem()); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(out, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// Query runs query on conn and returns all the rows scanned into T.
+func Query[T any](ctx context.Context, conn PGConn, query string, args ...interface{}) ([]T, error) {
+	result := []T{}
+	for row, err := range QueryRows[T](ctx, conn, query, args...) {
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+// QueryRow runs query on conn and returns the first row scanned into T.
+func QueryRow[T any](ctx context.Context, conn PGConn, query string, args ...interface{}) (T, error) {
+	for row, err := range QueryRows[T](ctx, conn, query, args...) {
+		return row, err
+	}
+	var zero T
+	return zero, errors.New(NoRowsReturnedErr)
+}
+
+type rowScanner struct {
+	columns []string
+	fields  [][]int
+}
+
+func newRowScanner(t reflect.Type, rows *sql.Rows) (rowScanner, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return rowScanner{}, err
+	}
+	scanner := rowScanner{columns: columns, fields: make([][]int, len(columns))}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		if len(columns) != 1 {
+			return rowScanner{}, fmt.Errorf(ScanColumnCountErr, len(columns), t)
+		}
+		scanner.fields[0] = []int{}
+		return scanner, nil
+	}
+	byName := make(map[string][]int)
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+		if name := columnName(field); name != "" {
+			byName[name] = field.Index
+		}
+	}
+	for idx, column := range columns {
+		scanner.fields[idx] = byName[column]
+	}
+	return scanner, nil
+}
+
+func columnName(field reflect.StructField) string {
+	tag := field.Tag.Get("db")
+	if tag == "" {
+		tag = field.Tag.Get("json")
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func (s rowScanner) scan(rows *sql.Rows, out reflect.Value) error {
+	values := make([]interface{}, len(s.columns))
+	for idx := range values {
+		values[idx] = new(interface{})
+	}
+	if err := rows.Scan(values...); err != nil {
+		return err
+	}
+	for idx, field := range s.fields {
+		if field == nil {
+			continue
+		}
+		dest := out
+		if len(field) > 0 {
+			dest = out.FieldByIndex(field)
+		}
+		if err := assignValue(dest, *(values[idx].(*interface{}))); err != nil {
+			return fmt.Errorf(ScanColumnErr, s.columns[idx], err)
+		}
+	}
+	return nil
+}
+
+func assignValue(dest reflect.Value, src interface{}) error {
+	if src == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+	if scanner, ok := dest.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(src)
+	}
+	switch v := src.(type) {
+	case []byte:
+		src = string(v)
+	case int32:
+		src = int64(v)
+	case int16:
+		src = int64(v)
+	case float32:
+		src = float64(v)
+	}
+	fail := fmt.Errorf(ScanTypeErr, src, dest.Type())
+	switch dest.Kind() {
+	case reflect.String:
+		switch v := src.(type) {
+		case string:
+			dest.SetString(v)
+		case time.Time:
+			dest.SetString(v.Format(PostgresTimeFormat))
+		case int64, float64, bool:
+			dest.SetString(fmt.Sprint(v))
+		default:
+			return fail
+		}
+	case reflect.Bool:
+		switch v := src.(type) {
+		case bool:
+			dest.SetBool(v)
+		case string:
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return fail
+			}
+			dest.SetBool(parsed)
+		default:
+			return fail
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch v := src.(type) {
+		case int64:
+			dest.SetInt(v)
+		case float64:
+			if v != float64(int64(v)) {
+				return fail
+			}
+			dest.SetInt(int64(v))
+		case string:
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fail
+			}
+			dest.SetInt(parsed)
+		default:
+			return fail
+		}
+	case reflect.Float32, reflect.Float64:
+		switch v := src.(type) {
+		case float64:
+			dest.SetFloat(v)
+		case int64:
+			dest.SetFloat(float64(v))
+		case string:
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fail
+			}
+			dest.SetFloat(parsed)
+		default:
+			return fail
+		}
+	case reflect.Slice:
+		v, ok := src.(string)
+		if !ok || dest.Type().Elem().Kind() != reflect.String {
+			return fail
+		}
+		elems, err := parseTextArray(v)
+		if err != nil {
+			return err
+		}
+		dest.Set(reflect.ValueOf(elems).Convert(dest.Type()))
+	case reflect.Struct:
+		v, ok := src.(time.Time)
+		if !ok || dest.Type() != reflect.TypeOf(time.Time{}) {
+			return fail
+		}
+		dest.Set(reflect.ValueOf(v))
+	default:
+		return fail
+	}
+	return nil
+}
+
+// parseTextArray parses the text representation of a one-dimensional
+// PostgreSQL array such as {a,"b c",NULL}.
+func parseTextArray(value string) ([]string, error) {
+	if len(value) < 2 || value[0] != '{' || value[len(value)-1] != '}' {
+		return nil, fmt.Errorf(ScanTypeErr, value, "[]string")
+	}
+	result := []string{}
+	body := value[1 : len(value)-1]
+	if body == "" {
+		return result, nil
+	}
+	var current strings.Builder
+	quoted, wasQuoted := false, false
+	for idx := 0; idx < len(body); idx++ {
+		c := body[idx]
+		switch {
+		case c == '\\' && idx+1 < len(body):
+			idx++
+			current.WriteByte(body[idx])
+		case c == '"':
+			quoted = !quoted
+			wasQuoted = true
+		case c == ',' && !quoted:
+			result = append(result, arrayElement(current.String(), wasQuoted))
+			current.Reset()
+			wasQuoted = false
+		default:
+			current.WriteByte(c)
+		}
+	}
+	result = append(result, arrayElement(current.String(), wasQuoted))
+	return result, nil
+}
+
+func arrayElement(value string, quoted bool) string {
+	if !quoted && value == "NULL" {
+		return ""
+	}
+	return value
+}
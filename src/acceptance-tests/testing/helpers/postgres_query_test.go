@@ -0,0 +1,132 @@
+package helpers_test
+
+import (
+	"context"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Typed queries", func() {
+	type sample struct {
+		Name    string   `db:"name"`
+		Count   int      `json:"count"`
+		Ratio   float64  `db:"ratio"`
+		Enabled bool     `db:"enabled"`
+		Values  []string `db:"values"`
+		Ignored string   `db:"-"`
+		Other   string
+	}
+
+	var (
+		mock sqlmock.Sqlmock
+		conn helpers.PGConn
+		ctx  context.Context
+	)
+
+	BeforeEach(func() {
+		db, m, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		mock = m
+		conn = helpers.PGConn{DB: db}
+		ctx = context.Background()
+	})
+	AfterEach(func() {
+		Expect(mock.ExpectationsWereMet()).To(Succeed())
+		conn.DB.Close()
+	})
+
+	It("Scans columns into struct fields by tag", func() {
+		rows := sqlmock.NewRows([]string{"name", "count", "ratio", "enabled", "values", "unknown", "Other"}).
+			AddRow("a", int64(1), 0.5, true, []byte(`{x,"y z",NULL}`), "u", "o").
+			AddRow([]byte("b"), "2", "1.5", "f", nil, nil, nil)
+		mock.ExpectQuery("SELECT").WillReturnRows(rows)
+
+		result, err := helpers.Query[sample](ctx, conn, "SELECT")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal([]sample{
+			{Name: "a", Count: 1, Ratio: 0.5, Enabled: true, Values: []string{"x", "y z", ""}},
+			{Name: "b", Count: 2, Ratio: 1.5, Enabled: false},
+		}))
+	})
+
+	It("Scans a single column into a scalar", func() {
+		rows := sqlmock.NewRows([]string{"count"}).AddRow(int64(3)).AddRow(int64(4))
+		mock.ExpectQuery("SELECT").WithArgs("x").WillReturnRows(rows)
+
+		result, err := helpers.Query[int](ctx, conn, "SELECT", "x")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal([]int{3, 4}))
+	})
+
+	It("Renders timestamps the way PostgreSQL renders them in JSON", func() {
+		ts := time.Date(2017, 5, 5, 11, 0, 0, 0, time.FixedZone("", 0))
+		rows := sqlmock.NewRows([]string{"timestamptz"}).AddRow(ts)
+		mock.ExpectQuery("SELECT").WillReturnRows(rows)
+
+		result, err := helpers.QueryRow[string](ctx, conn, "SELECT")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal("2017-05-05T11:00:00+00:00"))
+	})
+
+	It("Fails to scan a query with several columns into a scalar", func() {
+		rows := sqlmock.NewRows([]string{"a", "b"}).AddRow(1, 2)
+		mock.ExpectQuery("SELECT").WillReturnRows(rows)
+
+		_, err := helpers.Query[int](ctx, conn, "SELECT")
+		Expect(err).To(MatchError(ContainSubstring("expected 1 to scan into int")))
+	})
+
+	It("Reports scan errors instead of truncating the result", func() {
+		rows := sqlmock.NewRows([]string{"name", "count"}).
+			AddRow("a", int64(1)).
+			AddRow("b", "not a number")
+		mock.ExpectQuery("SELECT").WillReturnRows(rows)
+
+		result, err := helpers.Query[sample](ctx, conn, "SELECT")
+		Expect(err).To(MatchError(ContainSubstring("Cannot scan column count")))
+		Expect(result).To(BeNil())
+	})
+
+	It("Reports row errors", func() {
+		rows := sqlmock.NewRows([]string{"name"}).AddRow("a").RowError(0, genericError)
+		mock.ExpectQuery("SELECT").WillReturnRows(rows)
+
+		_, err := helpers.Query[sample](ctx, conn, "SELECT")
+		Expect(err).To(MatchError(genericError))
+	})
+
+	It("Fails to read a single row if none is returned", func() {
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+		_, err := helpers.QueryRow[sample](ctx, conn, "SELECT")
+		Expect(err).To(MatchError(helpers.NoRowsReturnedErr))
+	})
+
+	It("Streams rows and closes them when the caller stops early", func() {
+		rows := sqlmock.NewRows([]string{"name"}).AddRow("a").AddRow("b").AddRow("c")
+		mock.ExpectQuery("SELECT").WillReturnRows(rows).RowsWillBeClosed()
+
+		var names []string
+		for row, err := range helpers.QueryRows[sample](ctx, conn, "SELECT") {
+			Expect(err).NotTo(HaveOccurred())
+			names = append(names, row.Name)
+			if len(names) == 2 {
+				break
+			}
+		}
+		Expect(names).To(Equal([]string{"a", "b"}))
+	})
+
+	It("Reports scan errors from the JSON runner", func() {
+		rows := sqlmock.NewRows(expectedcolumns).AddRow("{}").AddRow(nil)
+		mock.ExpectQuery(convertQuery("SELECT 1")).WillReturnRows(rows)
+
+		_, err := conn.Run("SELECT 1")
+		Expect(err).To(HaveOccurred())
+	})
+})
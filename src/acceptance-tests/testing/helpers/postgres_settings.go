@@ -0,0 +1,248 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const InvalidBoolSettingErr = "%q is not a boolean"
+const InvalidNumericSettingErr = "%q is not a number"
+const InvalidSettingUnitErr = "invalid unit %q for a setting in %q"
+const InvalidEnumSettingErr = "%q is not one of %s"
+
+const GetServerTimesQuery = "SELECT pg_postmaster_start_time() AS start_time, pg_conf_load_time() AS conf_load_time"
+
+// How the server took a configuration change, as told by ServerTimes.
+const (
+	ServerUnchanged = "unchanged"
+	ServerReloaded  = "reloaded"
+	ServerRestarted = "restarted"
+)
+
+// Units accepted in configuration values, relative to the smallest one of
+// their kind: bytes for memory and milliseconds for time.
+var memoryUnits = map[string]float64{
+	"B":  1,
+	"kB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+var timeUnits = map[string]float64{
+	"us":  0.001,
+	"ms":  1,
+	"s":   1000,
+	"min": 60 * 1000,
+	"h":   60 * 60 * 1000,
+	"d":   24 * 60 * 60 * 1000,
+}
+
+// ReadSettingDetails returns every row of pg_settings by name.
+func (pg PGData) ReadSettingDetails() (map[string]PGSetting, error) {
+	return pg.ReadSettingDetailsContext(context.Background())
+}
+func (pg PGData) ReadSettingDetailsContext(ctx context.Context) (map[string]PGSetting, error) {
+	result := make(map[string]PGSetting)
+	conn, err := pg.GetDefaultConnectionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for out, err := range QueryRows[PGSetting](ctx, conn, GetSettingsQuery) {
+		if err != nil {
+			return nil, err
+		}
+		result[out.Name] = out
+	}
+	return result, nil
+}
+
+// Paths the postgres job template points the server to.
+const (
+	PostgresPidFile        = "/var/vcap/sys/run/postgres/postgres.pid"
+	PostgresLogDir         = "/var/vcap/sys/log/postgres"
+	PostgresCertificateDir = "/var/vcap/jobs/postgres/config/certificates"
+)
+
+// ExpectedSettings returns the settings postgresql.conf.erb writes for props,
+// by their pg_settings name and with the values as written in the file.
+// additional_config comes last in the file, so it overrides the others.
+// DateStyle is given the way PostgreSQL reports it, as it rewrites
+// 'iso, mdy' when it parses the file.
+func ExpectedSettings(props Properties) PgAdditionalConfigMap {
+	p := props.Databases
+	result := PgAdditionalConfigMap{
+		"listen_addresses":           "0.0.0.0",
+		"port":                       p.Port,
+		"max_connections":            p.MaxConnections,
+		"external_pid_file":          PostgresPidFile,
+		"authentication_timeout":     "1min",
+		"shared_buffers":             "128MB",
+		"temp_buffers":               "8MB",
+		"max_files_per_process":      1000,
+		"logging_collector":          "on",
+		"log_directory":              PostgresLogDir,
+		"log_filename":               "postgresql.log",
+		"log_line_prefix":            p.LogLinePrefix,
+		"DateStyle":                  "ISO, MDY",
+		"lc_messages":                "en_US.UTF-8",
+		"lc_monetary":                "en_US.UTF-8",
+		"lc_numeric":                 "en_US.UTF-8",
+		"lc_time":                    "en_US.UTF-8",
+		"default_text_search_config": "pg_catalog.english",
+	}
+	if p.CollectStatementStats {
+		result["shared_preload_libraries"] = "pg_stat_statements"
+		result["track_activity_query_size"] = 4096
+		result["pg_stat_statements.track"] = "all"
+	}
+	if p.TLS.Certificate != "" {
+		result["ssl"] = "on"
+		if p.TLS.CA != "" {
+			result["ssl_ca_file"] = PostgresCertificateDir + "/server.ca_cert"
+		}
+		result["ssl_key_file"] = PostgresCertificateDir + "/server.private_key"
+		result["ssl_cert_file"] = PostgresCertificateDir + "/server.public_cert"
+	}
+	for key, value := range p.AdditionalConfig {
+		result[key] = value
+	}
+	return result
+}
+
+// PGServerTimes tells when the server was started and when it last loaded
+// its configuration files.
+type PGServerTimes struct {
+	StartTime    time.Time `db:"start_time"`
+	ConfLoadTime time.Time `db:"conf_load_time"`
+}
+
+func (pg PGData) GetServerTimes() (PGServerTimes, error) {
+	return pg.GetServerTimesContext(context.Background())
+}
+func (pg PGData) GetServerTimesContext(ctx context.Context) (PGServerTimes, error) {
+	conn, err := pg.GetDefaultConnectionContext(ctx)
+	if err != nil {
+		return PGServerTimes{}, err
+	}
+	return QueryRow[PGServerTimes](ctx, conn, GetServerTimesQuery)
+}
+
+// ChangeSince tells whether the server was restarted or only reloaded its
+// configuration between before and t. A restart also loads the
+// configuration, so it takes precedence.
+func (t PGServerTimes) ChangeSince(before PGServerTimes) string {
+	if !t.StartTime.Equal(before.StartTime) {
+		return ServerRestarted
+	}
+	if !t.ConfLoadTime.Equal(before.ConfLoadTime) {
+		return ServerReloaded
+	}
+	return ServerUnchanged
+}
+
+// Matches reports whether value, as written in postgresql.conf, sets the
+// setting to its current value. Sizes and durations are converted to the
+// unit of the setting, booleans and enums are compared the way PostgreSQL
+// parses them, and strings must be identical.
+func (s PGSetting) Matches(value interface{}) (bool, error) {
+	input := fmt.Sprintf("%v", value)
+	if s.VarType != "string" {
+		input = strings.TrimSpace(input)
+	}
+	switch s.VarType {
+	case "bool":
+		expected, err := parseBoolSetting(input)
+		if err != nil {
+			return false, err
+		}
+		actual, err := parseBoolSetting(s.Setting)
+		if err != nil {
+			return false, err
+		}
+		return expected == actual, nil
+	case "integer", "real":
+		expected, err := parseNumericSetting(input, s.Unit)
+		if err != nil {
+			return false, err
+		}
+		actual, err := strconv.ParseFloat(s.Setting, 64)
+		if err != nil {
+			return false, fmt.Errorf(InvalidNumericSettingErr, s.Setting)
+		}
+		if s.VarType == "integer" {
+			return math.Round(expected) == actual, nil
+		}
+		return math.Abs(expected-actual) <= 1e-9*math.Max(1, math.Abs(actual)), nil
+	case "enum":
+		for _, enumVal := range s.EnumVals {
+			if strings.EqualFold(input, enumVal) {
+				return strings.EqualFold(input, s.Setting), nil
+			}
+		}
+		if len(s.EnumVals) > 0 {
+			return false, fmt.Errorf(InvalidEnumSettingErr, input, strings.Join(s.EnumVals, ", "))
+		}
+		return strings.EqualFold(input, s.Setting), nil
+	}
+	return input == s.Setting, nil
+}
+
+// parseBoolSetting accepts on, off, true, false, yes, no, 1, 0 and any
+// unambiguous prefix of them, ignoring case.
+func parseBoolSetting(value string) (bool, error) {
+	lower := strings.ToLower(value)
+	switch {
+	case lower == "1":
+		return true, nil
+	case lower == "0":
+		return false, nil
+	case lower == "on":
+		return true, nil
+	case len(lower) >= 2 && strings.HasPrefix("off", lower):
+		return false, nil
+	case lower != "" && strings.HasPrefix("true", lower), lower != "" && strings.HasPrefix("yes", lower):
+		return true, nil
+	case lower != "" && strings.HasPrefix("false", lower), lower != "" && strings.HasPrefix("no", lower):
+		return false, nil
+	}
+	return false, fmt.Errorf(InvalidBoolSettingErr, value)
+}
+
+// parseNumericSetting returns value expressed in baseUnit, the unit of the
+// setting in pg_settings such as "8kB", "MB" or "ms". A value without a unit
+// is already in baseUnit.
+func parseNumericSetting(value string, baseUnit string) (float64, error) {
+	end := len(value)
+	for i, r := range value {
+		if !strings.ContainsRune("0123456789.+-eE", r) || ((r == 'e' || r == 'E') && i == 0) {
+			end = i
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil {
+		return 0, fmt.Errorf(InvalidNumericSettingErr, value)
+	}
+	unit := strings.TrimSpace(value[end:])
+	if unit == "" {
+		return number, nil
+	}
+
+	baseMultiplier, baseName := 1.0, baseUnit
+	if idx := strings.IndexFunc(baseUnit, func(r rune) bool { return r < '0' || r > '9' }); idx > 0 {
+		baseMultiplier, _ = strconv.ParseFloat(baseUnit[:idx], 64)
+		baseName = baseUnit[idx:]
+	}
+	for _, units := range []map[string]float64{memoryUnits, timeUnits} {
+		factor, ok := units[unit]
+		base, baseOk := units[baseName]
+		if ok && baseOk {
+			return number * factor / (base * baseMultiplier), nil
+		}
+	}
+	return 0, fmt.Errorf(InvalidSettingUnitErr, unit, baseUnit)
+}
@@ -0,0 +1,173 @@
+package helpers_test
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Settings", func() {
+	It("Reads the unit, type and enum values of every setting", func() {
+		pg := helpers.PGData{Conns: helpers.NewPGConnRegistry()}
+		db, mock, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		pg.AddConnection(helpers.DefaultDB, pg.Data.DefUser, db)
+		DeferCleanup(pg.CloseConnections)
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.GetSettingsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"name", "setting", "unit", "category", "vartype", "enumvals"}).
+				AddRow("shared_buffers", "16384", "8kB", "Resource Usage / Memory", "integer", nil).
+				AddRow("wal_level", "replica", nil, "Write-Ahead Log / Settings", "enum", "{minimal,replica,logical}"))
+
+		details, err := pg.ReadSettingDetailsContext(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(details).To(Equal(map[string]helpers.PGSetting{
+			"shared_buffers": {Name: "shared_buffers", Setting: "16384", Unit: "8kB", VarType: "integer"},
+			"wal_level":      {Name: "wal_level", Setting: "replica", VarType: "enum", EnumVals: []string{"minimal", "replica", "logical"}},
+		}))
+	})
+
+	It("Reads where each setting comes from and whether it waits for a restart", func() {
+		pg := helpers.PGData{Conns: helpers.NewPGConnRegistry()}
+		db, mock, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		pg.AddConnection(helpers.DefaultDB, pg.Data.DefUser, db)
+		DeferCleanup(pg.CloseConnections)
+		mock.ExpectQuery(regexp.QuoteMeta(helpers.GetSettingsQuery)).WillReturnRows(
+			sqlmock.NewRows([]string{"name", "setting", "vartype", "source", "sourcefile", "pending_restart"}).
+				AddRow("max_connections", "30", "integer", "configuration file", "/var/vcap/jobs/postgres/config/postgresql.conf", true).
+				AddRow("work_mem", "4096", "integer", "default", nil, false))
+
+		details, err := pg.ReadSettingDetailsContext(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(details).To(Equal(map[string]helpers.PGSetting{
+			"max_connections": {Name: "max_connections", Setting: "30", VarType: "integer", Source: "configuration file", SourceFile: "/var/vcap/jobs/postgres/config/postgresql.conf", PendingRestart: true},
+			"work_mem":        {Name: "work_mem", Setting: "4096", VarType: "integer", Source: "default"},
+		}))
+	})
+
+	Context("Settings written by the job template", func() {
+		var props helpers.Properties
+
+		BeforeEach(func() {
+			props = helpers.Properties{Databases: helpers.PgProperties{Port: 5524, MaxConnections: 500, LogLinePrefix: "%m: "}}
+		})
+
+		It("Includes the fixed settings and the ones from the properties", func() {
+			expected := helpers.ExpectedSettings(props)
+			Expect(expected).To(HaveKeyWithValue("listen_addresses", "0.0.0.0"))
+			Expect(expected).To(HaveKeyWithValue("port", 5524))
+			Expect(expected).To(HaveKeyWithValue("max_connections", 500))
+			Expect(expected).To(HaveKeyWithValue("log_line_prefix", "%m: "))
+			Expect(expected).To(HaveKeyWithValue("external_pid_file", "/var/vcap/sys/run/postgres/postgres.pid"))
+			Expect(expected).To(HaveKeyWithValue("logging_collector", "on"))
+			Expect(expected).To(HaveKeyWithValue("log_directory", "/var/vcap/sys/log/postgres"))
+			Expect(expected).To(HaveKeyWithValue("log_filename", "postgresql.log"))
+			Expect(expected).To(HaveKeyWithValue("DateStyle", "ISO, MDY"))
+			Expect(expected).To(HaveKeyWithValue("lc_messages", "en_US.UTF-8"))
+			Expect(expected).To(HaveKeyWithValue("lc_monetary", "en_US.UTF-8"))
+			Expect(expected).To(HaveKeyWithValue("lc_numeric", "en_US.UTF-8"))
+			Expect(expected).To(HaveKeyWithValue("lc_time", "en_US.UTF-8"))
+			Expect(expected).To(HaveKeyWithValue("default_text_search_config", "pg_catalog.english"))
+			Expect(expected).NotTo(HaveKey("ssl"))
+			Expect(expected).NotTo(HaveKey("shared_preload_libraries"))
+		})
+		It("Includes pg_stat_statements when statement statistics are collected", func() {
+			props.Databases.CollectStatementStats = true
+			expected := helpers.ExpectedSettings(props)
+			Expect(expected).To(HaveKeyWithValue("shared_preload_libraries", "pg_stat_statements"))
+			Expect(expected).To(HaveKeyWithValue("track_activity_query_size", 4096))
+			Expect(expected).To(HaveKeyWithValue("pg_stat_statements.track", "all"))
+		})
+		It("Includes the certificate files when TLS is set", func() {
+			props.Databases.TLS = helpers.PgTLS{Certificate: "cert", PrivateKey: "key"}
+			expected := helpers.ExpectedSettings(props)
+			Expect(expected).To(HaveKeyWithValue("ssl", "on"))
+			Expect(expected).To(HaveKeyWithValue("ssl_key_file", "/var/vcap/jobs/postgres/config/certificates/server.private_key"))
+			Expect(expected).To(HaveKeyWithValue("ssl_cert_file", "/var/vcap/jobs/postgres/config/certificates/server.public_cert"))
+			Expect(expected).NotTo(HaveKey("ssl_ca_file"))
+
+			props.Databases.TLS.CA = "ca"
+			Expect(helpers.ExpectedSettings(props)).To(HaveKeyWithValue("ssl_ca_file", "/var/vcap/jobs/postgres/config/certificates/server.ca_cert"))
+		})
+		It("Lets additional_config override the other settings", func() {
+			props.Databases.AdditionalConfig = helpers.PgAdditionalConfigMap{"shared_buffers": "1GB", "work_mem": "8MB"}
+			expected := helpers.ExpectedSettings(props)
+			Expect(expected).To(HaveKeyWithValue("shared_buffers", "1GB"))
+			Expect(expected).To(HaveKeyWithValue("work_mem", "8MB"))
+		})
+	})
+
+	Context("Server times", func() {
+		start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		load := start.Add(time.Second)
+
+		It("Reads the start and configuration load times", func() {
+			pg := helpers.PGData{Conns: helpers.NewPGConnRegistry()}
+			db, mock, err := sqlmock.New()
+			Expect(err).NotTo(HaveOccurred())
+			pg.AddConnection(helpers.DefaultDB, pg.Data.DefUser, db)
+			DeferCleanup(pg.CloseConnections)
+			mock.ExpectQuery(regexp.QuoteMeta(helpers.GetServerTimesQuery)).WillReturnRows(
+				sqlmock.NewRows([]string{"start_time", "conf_load_time"}).AddRow(start, load))
+
+			times, err := pg.GetServerTimesContext(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(times).To(Equal(helpers.PGServerTimes{StartTime: start, ConfLoadTime: load}))
+		})
+
+		DescribeTable("Telling a restart from a reload",
+			func(after helpers.PGServerTimes, expected string) {
+				before := helpers.PGServerTimes{StartTime: start, ConfLoadTime: load}
+				Expect(after.ChangeSince(before)).To(Equal(expected))
+			},
+			Entry("nothing changed", helpers.PGServerTimes{StartTime: start, ConfLoadTime: load}, helpers.ServerUnchanged),
+			Entry("the configuration was loaded again", helpers.PGServerTimes{StartTime: start, ConfLoadTime: load.Add(time.Minute)}, helpers.ServerReloaded),
+			Entry("the server was started again", helpers.PGServerTimes{StartTime: start.Add(time.Minute), ConfLoadTime: load.Add(time.Minute)}, helpers.ServerRestarted),
+		)
+	})
+
+	DescribeTable("Comparing configuration values with pg_settings",
+		func(setting helpers.PGSetting, value interface{}, expected bool) {
+			match, err := setting.Matches(value)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(match).To(Equal(expected))
+		},
+		Entry("a size in MB", helpers.PGSetting{Setting: "16384", Unit: "8kB", VarType: "integer"}, "128MB", true),
+		Entry("a size in GB", helpers.PGSetting{Setting: "4194304", Unit: "kB", VarType: "integer"}, "4GB", true),
+		Entry("a different size", helpers.PGSetting{Setting: "16384", Unit: "8kB", VarType: "integer"}, "256MB", false),
+		Entry("a size in the setting unit", helpers.PGSetting{Setting: "16384", Unit: "8kB", VarType: "integer"}, 16384, true),
+		Entry("a duration in seconds", helpers.PGSetting{Setting: "1000", Unit: "ms", VarType: "integer"}, "1s", true),
+		Entry("a duration in minutes", helpers.PGSetting{Setting: "300", Unit: "s", VarType: "integer"}, "5min", true),
+		Entry("a duration with a space", helpers.PGSetting{Setting: "1800", Unit: "s", VarType: "integer"}, "30 min", true),
+		Entry("a special value", helpers.PGSetting{Setting: "-1", Unit: "ms", VarType: "integer"}, -1, true),
+		Entry("on as true", helpers.PGSetting{Setting: "on", VarType: "bool"}, true, true),
+		Entry("a prefix of yes", helpers.PGSetting{Setting: "on", VarType: "bool"}, "Y", true),
+		Entry("off as 0", helpers.PGSetting{Setting: "off", VarType: "bool"}, "0", true),
+		Entry("off as on", helpers.PGSetting{Setting: "off", VarType: "bool"}, "on", false),
+		Entry("a real number", helpers.PGSetting{Setting: "0.2", VarType: "real"}, 0.2, true),
+		Entry("a real number as an integer", helpers.PGSetting{Setting: "2", Unit: "ms", VarType: "real"}, "2", true),
+		Entry("a real number with a unit", helpers.PGSetting{Setting: "2", Unit: "ms", VarType: "real"}, "2000us", true),
+		Entry("an enum in upper case", helpers.PGSetting{Setting: "replica", VarType: "enum", EnumVals: []string{"minimal", "replica", "logical"}}, "REPLICA", true),
+		Entry("another enum value", helpers.PGSetting{Setting: "replica", VarType: "enum", EnumVals: []string{"minimal", "replica", "logical"}}, "logical", false),
+		Entry("a string", helpers.PGSetting{Setting: "%m: ", VarType: "string"}, "%m: ", true),
+		Entry("a string differing in case", helpers.PGSetting{Setting: "UTC", VarType: "string"}, "utc", false),
+	)
+
+	DescribeTable("Rejecting values PostgreSQL would not accept",
+		func(setting helpers.PGSetting, value interface{}, expected string) {
+			_, err := setting.Matches(value)
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("an ambiguous boolean", helpers.PGSetting{Setting: "on", VarType: "bool"}, "o", `"o" is not a boolean`),
+		Entry("a word for a number", helpers.PGSetting{Setting: "100", VarType: "integer"}, "many", `"many" is not a number`),
+		Entry("a time unit for a size", helpers.PGSetting{Setting: "16384", Unit: "8kB", VarType: "integer"}, "10s", `invalid unit "s" for a setting in "8kB"`),
+		Entry("a unit for a plain number", helpers.PGSetting{Setting: "100", VarType: "integer"}, "100MB", `invalid unit "MB" for a setting in ""`),
+		Entry("a value outside the enum", helpers.PGSetting{Setting: "replica", VarType: "enum", EnumVals: []string{"minimal", "replica", "logical"}}, "archive", `"archive" is not one of minimal, replica, logical`),
+	)
+})
@@ -1,11 +1,14 @@
 package helpers_test
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
@@ -15,138 +18,162 @@ import (
 )
 
 var expectedcolumns = []string{"row_to_json"}
+var roleColumns = []string{"rolname", "rolsuper", "rolinherit", "rolcreaterole", "rolcreatedb", "rolcanlogin", "rolreplication", "rolbypassrls", "rolconnlimit", "rolvaliduntil"}
+var tableColumns = []string{"schemaname", "tablename", "tableowner", "hasindexes"}
 var genericError = fmt.Errorf("some error")
 
-func convertQuery(query string) string {
-	//return helpers.GetFormattedQuery(query)
-	result := strings.Replace(helpers.GetFormattedQuery(query), ")", "\\)", -1)
+func escapeQuery(query string) string {
+	result := strings.Replace(query, ")", "\\)", -1)
 	result = strings.Replace(result, "(", "\\(", -1)
 	result = strings.Replace(result, ":", "\\:", -1)
 	result = strings.Replace(result, "+", "\\+", -1)
 	result = strings.Replace(result, "'", "\\'", -1)
+	result = strings.Replace(result, "$", "\\$", -1)
 	return strings.Replace(result, "*", "(.+)", -1)
 }
 
+func convertQuery(query string) string {
+	return escapeQuery(helpers.GetFormattedQuery(query))
+}
+
+func roleRow(role helpers.PGRole) []driver.Value {
+	var validUntil driver.Value
+	if role.ValidUntil != "" {
+		validUntil = role.ValidUntil
+	}
+	return []driver.Value{role.Name, role.Super, role.Inherit, role.CreateRole, role.CreateDb, role.CanLogin, role.Replication, role.BypassRLS, int64(role.ConnLimit), validUntil}
+}
+
+func quoteQualifiedName(parts ...string) string {
+	result, err := helpers.QuoteQualifiedName(parts...)
+	Expect(err).NotTo(HaveOccurred())
+	return result
+}
+
+// mockSuperUserConnections returns a PGData with a mocked superuser pool on
+// each of dbNames, and the mocks by database name. The mocks must have been
+// met when the spec ends, and the pools are closed.
+func mockSuperUserConnections(dbNames ...string) (helpers.PGData, map[string]sqlmock.Sqlmock) {
+	pg := helpers.PGData{
+		Data:  helpers.PGCommon{AdminUser: helpers.User{Name: "superUser", Password: "superPassword"}},
+		Conns: helpers.NewPGConnRegistry(),
+	}
+	mocks := make(map[string]sqlmock.Sqlmock)
+	for _, dbName := range dbNames {
+		db, mock, err := sqlmock.New()
+		Expect(err).NotTo(HaveOccurred())
+		mocks[dbName] = mock
+		pg.AddConnection(dbName, pg.Data.AdminUser, db)
+	}
+	DeferCleanup(func() {
+		defer pg.CloseConnections()
+		for _, dbName := range dbNames {
+			Expect(mocks[dbName].ExpectationsWereMet()).To(Succeed())
+		}
+	})
+	return pg, mocks
+}
+
 func mockSettings(expected map[string]string, mocks map[string]sqlmock.Sqlmock) {
 	if expected == nil {
-		mocks[helpers.DefaultDB].ExpectQuery(convertQuery(helpers.GetSettingsQuery)).WillReturnError(genericError)
+		mocks[helpers.DefaultDB].ExpectQuery(escapeQuery(helpers.GetSettingsQuery)).WillReturnError(genericError)
 	} else {
-		rows := sqlmock.NewRows(expectedcolumns)
+		rows := sqlmock.NewRows([]string{"name", "setting", "some1", "vartype"})
 		for key, value := range expected {
-			ff := "{\"name\": \"%s\", \"setting\": \"%s\", \"some1\": \"%s\",\"vartype\": \"%s\"}"
-			row := fmt.Sprintf(ff, key, value, "some0", "string")
-			rows = rows.AddRow(row)
+			rows = rows.AddRow(key, value, "some0", "string")
 		}
-		mocks[helpers.DefaultDB].ExpectQuery(convertQuery(helpers.GetSettingsQuery)).WillReturnRows(rows)
+		mocks[helpers.DefaultDB].ExpectQuery(escapeQuery(helpers.GetSettingsQuery)).WillReturnRows(rows)
 	}
 }
 
 func mockDatabases(expected []helpers.PGDatabase, mocks map[string]sqlmock.Sqlmock) {
+	localesQuery, _ := helpers.DatabaseLocalesFeature.QueryFor(helpers.PGVersionFromNum(160000))
+	mocks["dbsuper"].ExpectQuery(helpers.ServerVersionNumQuery).WillReturnRows(sqlmock.NewRows([]string{"server_version_num"}).AddRow(160000))
 	if expected == nil {
-		mocks["dbsuper"].ExpectQuery(convertQuery(helpers.ListDatabasesQuery)).WillReturnError(genericError)
+		mocks["dbsuper"].ExpectQuery(regexp.QuoteMeta(localesQuery)).WillReturnError(genericError)
 	} else {
-		rows := sqlmock.NewRows(expectedcolumns)
+		rows := sqlmock.NewRows([]string{"datname", "encoding", "datcollate", "datctype", "locale_provider"})
 		for _, elem := range expected {
-			ff := "{\"datname\": \"%s\"}"
-			row := fmt.Sprintf(ff, elem.Name)
-			rows = rows.AddRow(row)
-			extrows := sqlmock.NewRows(expectedcolumns)
+			rows = rows.AddRow(elem.Name, elem.Encoding, elem.Collate, elem.CType, elem.LocaleProvider)
+			extrows := sqlmock.NewRows([]string{"extname", "extversion", "schema", "default_version"})
 			for _, elem := range elem.DBExts {
-				xx := "{\"extname\": \"%s\"}"
-				extrow := fmt.Sprintf(xx, elem.Name)
-				extrows = extrows.AddRow(extrow)
+				extrows = extrows.AddRow(elem.Name, elem.Version, elem.Schema, elem.DefaultVersion)
 			}
-			mocks[elem.Name+"super"].ExpectQuery(convertQuery(helpers.ListDBExtensionsQuery)).WillReturnRows(extrows)
-			tableRows := sqlmock.NewRows(expectedcolumns)
+			mocks[elem.Name+"super"].ExpectQuery(escapeQuery(helpers.ListDBExtensionsQuery)).WillReturnRows(extrows)
+			tableRows := sqlmock.NewRows(tableColumns)
 			for _, tElem := range elem.Tables {
-				xx := "{\"schemaname\": \"%s\", \"tablename\":\"%s\",\"tableowner\":\"%s\"}"
-				tableRow := fmt.Sprintf(xx, tElem.SchemaName, tElem.TableName, tElem.TableOwner)
-				tableRows = tableRows.AddRow(tableRow)
+				tableRows = tableRows.AddRow(tElem.SchemaName, tElem.TableName, tElem.TableOwner, true)
 			}
-			mocks[elem.Name+"super"].ExpectQuery(convertQuery(helpers.ListTablesQuery)).WillReturnRows(tableRows)
+			mocks[elem.Name+"super"].ExpectQuery(escapeQuery(helpers.ListTablesQuery)).WillReturnRows(tableRows)
 			for _, tElem := range elem.Tables {
-				columnRows := sqlmock.NewRows(expectedcolumns)
+				columnRows := sqlmock.NewRows([]string{"column_name", "data_type", "ordinal_position"})
 				for _, col := range tElem.TableColumns {
-					xx := "{\"column_name\": \"%s\", \"data_type\":\"%s\",\"ordinal_position\":%d}"
-					columnRow := fmt.Sprintf(xx, col.ColumnName, col.DataType, col.Position)
-					columnRows = columnRows.AddRow(columnRow)
-				}
-				mocks[elem.Name+"super"].ExpectQuery(convertQuery(fmt.Sprintf(helpers.ListTableColumnsQuery, tElem.SchemaName, tElem.TableName))).WillReturnRows(columnRows)
-				countRows := sqlmock.NewRows(expectedcolumns)
-				countRows = countRows.AddRow(fmt.Sprintf("{\"count\": %d}", tElem.TableRowsCount.Num))
-				mocks[elem.Name+"super"].ExpectQuery(convertQuery(fmt.Sprintf(helpers.CountTableRowsQuery, tElem.TableName))).WillReturnRows(countRows)
+					columnRows = columnRows.AddRow(col.ColumnName, col.DataType, int64(col.Position))
+				}
+				mocks[elem.Name+"super"].ExpectQuery(escapeQuery(helpers.ListTableColumnsQuery)).WithArgs(tElem.SchemaName, tElem.TableName).WillReturnRows(columnRows)
+				countRows := sqlmock.NewRows([]string{"count"}).AddRow(int64(tElem.TableRowsCount.Num))
+				mocks[elem.Name+"super"].ExpectQuery(escapeQuery(fmt.Sprintf(helpers.CountTableRowsQuery, quoteQualifiedName(tElem.SchemaName, tElem.TableName)))).WillReturnRows(countRows)
+				if tElem.Checksum != "" {
+					checksumRows := sqlmock.NewRows([]string{"checksum"}).AddRow(tElem.Checksum)
+					mocks[elem.Name+"super"].ExpectQuery(escapeQuery(fmt.Sprintf(helpers.TableChecksumQuery, quoteQualifiedName(tElem.SchemaName, tElem.TableName)))).WillReturnRows(checksumRows)
+				}
 			}
 		}
-		mocks["dbsuper"].ExpectQuery(convertQuery(helpers.ListDatabasesQuery)).WillReturnRows(rows)
+		mocks["dbsuper"].ExpectQuery(regexp.QuoteMeta(localesQuery)).WillReturnRows(rows)
 	}
 }
 func mockRoles(expected map[string]helpers.PGRole, mocks map[string]sqlmock.Sqlmock) error {
 	if expected == nil {
-		mocks[helpers.DefaultDB].ExpectQuery(convertQuery(helpers.ListRolesQuery)).WillReturnError(genericError)
+		mocks[helpers.DefaultDB].ExpectQuery(escapeQuery(helpers.ListRolesQuery)).WillReturnError(genericError)
 	} else {
-		rows := sqlmock.NewRows(expectedcolumns)
+		rows := sqlmock.NewRows(roleColumns)
 		for _, elem := range expected {
-			row, err := json.Marshal(elem)
-			if err != nil {
-				return err
-			}
-			rows = rows.AddRow(row)
+			rows = rows.AddRow(roleRow(elem)...)
 		}
-		mocks[helpers.DefaultDB].ExpectQuery(convertQuery(helpers.ListRolesQuery)).WillReturnRows(rows)
+		mocks[helpers.DefaultDB].ExpectQuery(escapeQuery(helpers.ListRolesQuery)).WillReturnRows(rows)
 	}
 	return nil
 }
 func mockGetTable(expected map[string]helpers.PGTable, mocks map[string]sqlmock.Sqlmock, table_name string) error {
 	if expected == nil {
-		mocks["dbsuper"].ExpectQuery(convertQuery(fmt.Sprintf(helpers.GetTableQuery, table_name))).WillReturnError(genericError)
+		mocks["dbsuper"].ExpectQuery(escapeQuery(helpers.GetTableQuery)).WithArgs(table_name).WillReturnError(genericError)
 	} else {
-		rows := sqlmock.NewRows(expectedcolumns)
+		rows := sqlmock.NewRows(tableColumns)
 		for _, elem := range expected {
-			row, err := json.Marshal(elem)
-			if err != nil {
-				return err
-			}
-			rows = rows.AddRow(row)
+			rows = rows.AddRow(elem.SchemaName, elem.TableName, elem.TableOwner, false)
 		}
-		mocks["dbsuper"].ExpectQuery(convertQuery(fmt.Sprintf(helpers.GetTableQuery, table_name))).WillReturnRows(rows)
-		fmt.Println(convertQuery(fmt.Sprintf(helpers.GetTableQuery, table_name)))
+		mocks["dbsuper"].ExpectQuery(escapeQuery(helpers.GetTableQuery)).WithArgs(table_name).WillReturnRows(rows)
 	}
 	return nil
 }
 func mockGetRole(expected map[string]helpers.PGRole, mocks map[string]sqlmock.Sqlmock, role_name string) error {
 	if expected == nil {
-		mocks[helpers.DefaultDB].ExpectQuery(convertQuery(fmt.Sprintf(helpers.GetRoleQuery, role_name))).WillReturnError(genericError)
+		mocks[helpers.DefaultDB].ExpectQuery(escapeQuery(helpers.GetRoleQuery)).WithArgs(role_name).WillReturnError(genericError)
 	} else {
-		rows := sqlmock.NewRows(expectedcolumns)
+		rows := sqlmock.NewRows(roleColumns)
 		for _, elem := range expected {
-			row, err := json.Marshal(elem)
-			if err != nil {
-				return err
-			}
-			rows = rows.AddRow(row)
+			rows = rows.AddRow(roleRow(elem)...)
 		}
-		mocks[helpers.DefaultDB].ExpectQuery(convertQuery(fmt.Sprintf(helpers.GetRoleQuery, role_name))).WillReturnRows(rows)
+		mocks[helpers.DefaultDB].ExpectQuery(escapeQuery(helpers.GetRoleQuery)).WithArgs(role_name).WillReturnRows(rows)
 	}
 	return nil
 }
 func mockDate(current string, expected string, mocks map[string]sqlmock.Sqlmock) error {
-	sqlCommand := convertQuery(fmt.Sprintf(helpers.ConvertToDateCommand, current))
+	sqlCommand := escapeQuery(helpers.ConvertToDateCommand)
 	if expected == "" {
-		mocks[helpers.DefaultDB].ExpectQuery(sqlCommand).WillReturnError(genericError)
+		mocks[helpers.DefaultDB].ExpectQuery(sqlCommand).WithArgs(current).WillReturnError(genericError)
 	} else {
-		row := fmt.Sprintf("{\"timestamptz\": \"%s\"}", expected)
-		rows := sqlmock.NewRows(expectedcolumns).AddRow(row)
-		mocks[helpers.DefaultDB].ExpectQuery(sqlCommand).WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"timestamptz"}).AddRow(expected)
+		mocks[helpers.DefaultDB].ExpectQuery(sqlCommand).WithArgs(current).WillReturnRows(rows)
 	}
 	return nil
 }
 func mockPostgreSQLVersion(expected helpers.PGVersion, mocks map[string]sqlmock.Sqlmock) error {
-	sqlCommand := convertQuery(helpers.GetPostgreSQLVersionQuery)
+	sqlCommand := escapeQuery(helpers.GetPostgreSQLVersionQuery)
 	if expected.Version == "" {
 		mocks[helpers.DefaultDB].ExpectQuery(sqlCommand).WillReturnError(genericError)
 	} else {
-		row := fmt.Sprintf("{\"version\": \"%s\"}", expected.Version)
-		rows := sqlmock.NewRows(expectedcolumns).AddRow(row)
+		rows := sqlmock.NewRows([]string{"version"}).AddRow(expected.Version)
 		mocks[helpers.DefaultDB].ExpectQuery(sqlCommand).WillReturnRows(rows)
 	}
 	return nil
@@ -170,7 +197,10 @@ var _ = Describe("Postgres", func() {
 							Name: "db1",
 							DBExts: []helpers.PGDatabaseExtensions{
 								helpers.PGDatabaseExtensions{
-									Name: "exta",
+									Name:           "exta",
+									Version:        "1.1",
+									Schema:         "public",
+									DefaultVersion: "1.2",
 								},
 							},
 							Tables: []helpers.PGTable{
@@ -314,6 +344,37 @@ var _ = Describe("Postgres", func() {
 				_, err := helpers.NewPostgres(props)
 				Expect(err).To(MatchError(errors.New(helpers.IncorrectSSLModeErr)))
 			})
+			It("Fail if direct SSL negotiation is used with a weak sslmode", func() {
+				props := helpers.PGCommon{
+					Address:        "xx",
+					SSLMode:        "prefer",
+					SSLNegotiation: "direct",
+					Port:           10,
+					DefUser: helpers.User{
+						Name:     "uu",
+						Password: "pp",
+					},
+				}
+				_, err := helpers.NewPostgres(props)
+				Expect(err).To(MatchError(errors.New(helpers.WeakSSLModeForDirectNegotiationErr)))
+			})
+			It("Defaults the query timeout unless it is disabled", func() {
+				props := helpers.PGCommon{
+					Address: "xx",
+					Port:    10,
+					DefUser: helpers.User{
+						Name:     "uu",
+						Password: "pp",
+					},
+				}
+				pg, err := helpers.NewPostgres(props)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pg.Data.QueryTimeout).To(Equal(helpers.DefaultQueryTimeout))
+				props.QueryTimeout = helpers.NoQueryTimeout
+				pg, err = helpers.NewPostgres(props)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pg.Data.QueryTimeout).To(Equal(helpers.NoQueryTimeout))
+			})
 		})
 	})
 	Describe("Validate SSL mode", func() {
@@ -330,13 +391,9 @@ var _ = Describe("Postgres", func() {
 				Data: helpers.PGCommon{
 					SSLMode: "disable",
 				},
-				DBs: []helpers.PGConn{
-					helpers.PGConn{
-						DB:       db,
-						TargetDB: helpers.DefaultDB,
-					},
-				},
+				Conns: helpers.NewPGConnRegistry(),
 			}
+			pg.AddConnection(helpers.DefaultDB, pg.Data.DefUser, db)
 		})
 		AfterEach(func() {
 			pg.CloseConnections()
@@ -363,15 +420,51 @@ var _ = Describe("Postgres", func() {
 			It("Correctly close connections when changing ssl mode", func() {
 				_, err := pg.GetDefaultConnection()
 				Expect(err).NotTo(HaveOccurred())
-				Expect(pg.DBs).NotTo(BeNil())
+				Expect(pg.Conns.Len()).To(Equal(1))
 				err = pg.ChangeSSLMode("verify-full", "/some-path")
 				Expect(err).NotTo(HaveOccurred())
 				Expect(pg.Data.SSLMode).To(Equal("verify-full"))
-				conns := 0
-				if pg.DBs != nil {
-					conns = len(pg.DBs)
+				Expect(pg.Conns.Len()).To(BeZero())
+			})
+			It("Accepts every libpq ssl mode", func() {
+				for _, mode := range []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"} {
+					Expect(pg.ChangeSSLMode(mode, "/somepath")).To(Succeed())
+					Expect(pg.Data.SSLMode).To(Equal(mode))
 				}
-				Expect(conns).To(BeZero())
+			})
+		})
+		Context("Changing SSL negotiation", func() {
+			It("Fails to change to an invalid negotiation", func() {
+				err := pg.ChangeSSLNegotiation("unknown")
+				Expect(err).To(MatchError(errors.New(helpers.IncorrectSSLNegotiationErr)))
+			})
+			It("Fails to negotiate TLS directly unless TLS is required", func() {
+				for _, mode := range []string{"disable", "allow", "prefer"} {
+					Expect(pg.ChangeSSLMode(mode, "")).To(Succeed())
+					err := pg.ChangeSSLNegotiation("direct")
+					Expect(err).To(MatchError(errors.New(helpers.WeakSSLModeForDirectNegotiationErr)))
+				}
+			})
+			It("Negotiates TLS directly and keeps the pools apart", func() {
+				Expect(pg.ChangeSSLMode("require", "")).To(Succeed())
+				db, _, err := sqlmock.New()
+				Expect(err).NotTo(HaveOccurred())
+				pg.AddConnection(helpers.DefaultDB, pg.Data.DefUser, db)
+
+				err = pg.ChangeSSLNegotiation("direct")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pg.Data.SSLNegotiation).To(Equal("direct"))
+				Expect(pg.Conns.Len()).To(BeZero())
+				Expect(pg.ConnectionParams("db", helpers.User{Name: "u", Password: "p"}).String()).To(ContainSubstring("sslmode=require sslnegotiation=direct"))
+			})
+			It("Refuses to weaken the ssl mode while negotiating TLS directly", func() {
+				Expect(pg.ChangeSSLMode("verify-full", "/somepath")).To(Succeed())
+				Expect(pg.ChangeSSLNegotiation("direct")).To(Succeed())
+				err := pg.ChangeSSLMode("prefer", "")
+				Expect(err).To(MatchError(errors.New(helpers.WeakSSLModeForDirectNegotiationErr)))
+				Expect(pg.Data.SSLMode).To(Equal("verify-full"))
+				Expect(pg.ChangeSSLNegotiation("postgres")).To(Succeed())
+				Expect(pg.ChangeSSLMode("prefer", "")).To(Succeed())
 			})
 		})
 	})
@@ -412,39 +505,14 @@ var _ = Describe("Postgres", func() {
 						Password: "superPassword",
 					},
 				},
-				DBs: []helpers.PGConn{
-					helpers.PGConn{
-						DB:       db,
-						User:     "defUser",
-						TargetDB: helpers.DefaultDB,
-					},
-					helpers.PGConn{
-						DB:       db1,
-						User:     "defUser",
-						TargetDB: "db1",
-					},
-					helpers.PGConn{
-						DB:       db2,
-						User:     "defUser",
-						TargetDB: "db2",
-					},
-					helpers.PGConn{
-						DB:       dbsuper,
-						User:     "superUser",
-						TargetDB: helpers.DefaultDB,
-					},
-					helpers.PGConn{
-						DB:       db1super,
-						User:     "superUser",
-						TargetDB: "db1",
-					},
-					helpers.PGConn{
-						DB:       db2super,
-						User:     "superUser",
-						TargetDB: "db2",
-					},
-				},
+				Conns: helpers.NewPGConnRegistry(),
 			}
+			pg.AddConnection(helpers.DefaultDB, pg.Data.DefUser, db)
+			pg.AddConnection("db1", pg.Data.DefUser, db1)
+			pg.AddConnection("db2", pg.Data.DefUser, db2)
+			pg.AddConnection(helpers.DefaultDB, pg.Data.AdminUser, dbsuper)
+			pg.AddConnection("db1", pg.Data.AdminUser, db1super)
+			pg.AddConnection("db2", pg.Data.AdminUser, db2super)
 		})
 		AfterEach(func() {
 			pg.CloseConnections()
@@ -481,6 +549,52 @@ var _ = Describe("Postgres", func() {
 				}
 			})
 		})
+		Context("Run a query bound to a context", func() {
+			It("Cancels the query when the context is cancelled", func() {
+				query := "SELECT name,role FROM table"
+				rows := sqlmock.NewRows(expectedcolumns).AddRow("{}")
+				mocks[helpers.DefaultDB].ExpectQuery(convertQuery(query)).WillDelayFor(time.Second).WillReturnRows(rows)
+				conn, err := pg.GetDefaultConnection()
+				Expect(err).NotTo(HaveOccurred())
+				ctx, cancel := context.WithCancel(context.Background())
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					cancel()
+				}()
+				_, err = conn.RunContext(ctx, query)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("canceling query"))
+			})
+			It("Applies the per-call timeout", func() {
+				query := "SELECT name,role FROM table"
+				rows := sqlmock.NewRows(expectedcolumns).AddRow("{}")
+				mocks[helpers.DefaultDB].ExpectQuery(convertQuery(query)).WillDelayFor(time.Second).WillReturnRows(rows)
+				conn, err := pg.GetDefaultConnection()
+				Expect(err).NotTo(HaveOccurred())
+				conn.Timeout = 10 * time.Millisecond
+				_, err = conn.RunContext(context.Background(), query)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("canceling query"))
+			})
+			It("Does not bound the call when the timeout is disabled", func() {
+				query := "SELECT name,role FROM table"
+				rows := sqlmock.NewRows(expectedcolumns).AddRow("{}")
+				mocks[helpers.DefaultDB].ExpectQuery(convertQuery(query)).WillDelayFor(50 * time.Millisecond).WillReturnRows(rows)
+				conn, err := pg.GetDefaultConnection()
+				Expect(err).NotTo(HaveOccurred())
+				conn.Timeout = helpers.NoQueryTimeout
+				result, err := conn.RunContext(context.Background(), query)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal([]string{"{}"}))
+			})
+			It("Fails to execute a statement with an expired context", func() {
+				mocks[helpers.DefaultDB].ExpectExec(`DROP TABLE "table1"`).WillReturnResult(sqlmock.NewResult(1, 1))
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				err := pg.DropTableContext(ctx, helpers.DefaultDB, "table1")
+				Expect(err).To(MatchError(context.Canceled))
+			})
+		})
 		Context("Fail to retrieve env info", func() {
 			It("Fails to read postgresql version", func() {
 				mockPostgreSQLVersion(helpers.PGVersion{Version: ""}, mocks)
@@ -547,6 +661,91 @@ var _ = Describe("Postgres", func() {
 				Expect(result).To(BeFalse())
 			})
 		})
+		Context("Handle awkward object names", func() {
+			It("Quotes identifiers", func() {
+				Expect(helpers.QuoteIdentifier("sandbox-2")).To(Equal(`"sandbox-2"`))
+				Expect(helpers.QuoteIdentifier("MixedCase")).To(Equal(`"MixedCase"`))
+				Expect(helpers.QuoteIdentifier(`we"ird`)).To(Equal(`"we""ird"`))
+				Expect(helpers.QuoteIdentifier("o'brien")).To(Equal(`"o'brien"`))
+				Expect(helpers.QuoteQualifiedName("Other Schema", "sandbox-2")).To(Equal(`"Other Schema"."sandbox-2"`))
+			})
+			It("Refuses identifiers with a NUL character", func() {
+				_, err := helpers.QuoteIdentifier("trunc\x00ated")
+				Expect(err).To(MatchError(fmt.Sprintf(helpers.InvalidIdentifierErr, "trunc\x00ated")))
+				_, err = helpers.QuoteQualifiedName("public", "trunc\x00ated")
+				Expect(err).To(HaveOccurred())
+				err = pg.DropTable("db1", "trunc\x00ated")
+				Expect(err).To(MatchError(fmt.Sprintf(helpers.InvalidIdentifierErr, "trunc\x00ated")))
+			})
+			It("Binds role names as parameters", func() {
+				roleName := "o'brien; DROP ROLE vcap; --"
+				expected := map[string]helpers.PGRole{
+					roleName: helpers.PGRole{Name: roleName},
+				}
+				err := mockGetRole(expected, mocks, roleName)
+				Expect(err).NotTo(HaveOccurred())
+				result, err := pg.CheckRoleExist(roleName)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(BeTrue())
+				Expect(mocks[helpers.DefaultDB].ExpectationsWereMet()).To(Succeed())
+			})
+			It("Binds table names as parameters", func() {
+				tableName := `Mixed"Case'table`
+				expected := map[string]helpers.PGTable{
+					tableName: helpers.PGTable{TableName: tableName},
+				}
+				err := mockGetTable(expected, mocks, tableName)
+				Expect(err).NotTo(HaveOccurred())
+				result, err := pg.CheckTableExist(tableName, helpers.DefaultDB)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(BeTrue())
+				Expect(mocks["dbsuper"].ExpectationsWereMet()).To(Succeed())
+			})
+			It("Quotes schema and table names when listing tables", func() {
+				expected := []helpers.PGDatabase{
+					helpers.PGDatabase{
+						Name:   "db1",
+						DBExts: []helpers.PGDatabaseExtensions{},
+						Tables: []helpers.PGTable{
+							helpers.PGTable{
+								SchemaName: "Other Schema",
+								TableName:  "sandbox-2",
+								TableOwner: "Mixed Owner",
+								TableColumns: []helpers.PGTableColumn{
+									helpers.PGTableColumn{
+										ColumnName: "Column-1",
+										DataType:   "text",
+										Position:   1,
+									},
+								},
+								TableRowsCount: helpers.PGCount{Num: 3},
+							},
+						},
+					},
+				}
+				mockDatabases(expected, mocks)
+				result, err := pg.ListDatabases()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(expected))
+				Expect(mocks["db1super"].ExpectationsWereMet()).To(Succeed())
+			})
+			It("Quotes the table name when dropping a table", func() {
+				tableName := `restore"; DROP TABLE students; --`
+				mocks["db1"].ExpectExec(regexp.QuoteMeta(`DROP TABLE "restore""; DROP TABLE students; --"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+				err := pg.DropTable("db1", tableName)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mocks["db1"].ExpectationsWereMet()).To(Succeed())
+			})
+			It("Quotes the schema and table names when dropping a table of another schema", func() {
+				mocks["db1"].ExpectExec(regexp.QuoteMeta(`DROP TABLE "Other Schema"."sandbox-2"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mocks["db1"].ExpectExec(regexp.QuoteMeta(`DROP TABLE "we""ird.schema"."Mixed.Table"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+				err := pg.DropSchemaTable("db1", "Other Schema", "sandbox-2")
+				Expect(err).NotTo(HaveOccurred())
+				err = pg.DropSchemaTableContext(context.Background(), "db1", `we"ird.schema`, "Mixed.Table")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mocks["db1"].ExpectationsWereMet()).To(Succeed())
+			})
+		})
 		Context("Correctly retrieve env info", func() {
 			It("Correctly get postgresql version", func() {
 				version := "PostgreSQL 9.4.9"
@@ -751,14 +950,21 @@ var _ = Describe("Postgres", func() {
 					},
 					Databases: []helpers.PGDatabase{
 						helpers.PGDatabase{
-							Name:   "db1",
-							DBExts: []helpers.PGDatabaseExtensions{},
-							Tables: []helpers.PGTable{},
+							Name:           "db1",
+							Encoding:       "UTF8",
+							Collate:        "en_US.UTF-8",
+							CType:          "en_US.UTF-8",
+							LocaleProvider: "libc",
+							DBExts:         []helpers.PGDatabaseExtensions{},
+							Tables:         []helpers.PGTable{},
 						},
 					},
 					Settings: map[string]string{
 						"max_connections": "30",
 					},
+					SettingDetails: map[string]helpers.PGSetting{
+						"max_connections": {Name: "max_connections", Setting: "30", VarType: "string"},
+					},
 					Version: helpers.PGVersion{
 						Version: "PostgreSQL 9.4.9",
 					},
@@ -779,6 +985,45 @@ var _ = Describe("Postgres", func() {
 				Expect(result).NotTo(BeZero())
 				Expect(result).To(Equal(expected))
 			})
+			It("Correctly retrieves table checksums when requested", func() {
+				expected := helpers.PGOutputData{
+					Roles: map[string]helpers.PGRole{},
+					Databases: []helpers.PGDatabase{
+						helpers.PGDatabase{
+							Name:   "db1",
+							DBExts: []helpers.PGDatabaseExtensions{},
+							Tables: []helpers.PGTable{
+								helpers.PGTable{
+									SchemaName:     "public",
+									TableName:      "sandbox-2",
+									TableOwner:     "owner",
+									TableColumns:   []helpers.PGTableColumn{},
+									TableRowsCount: helpers.PGCount{Num: 2},
+									Checksum:       "0cc175b9c0f1b6a831c399e269772661",
+								},
+							},
+						},
+					},
+					Settings: map[string]string{
+						"max_connections": "30",
+					},
+					SettingDetails: map[string]helpers.PGSetting{
+						"max_connections": {Name: "max_connections", Setting: "30", VarType: "string"},
+					},
+					Version: helpers.PGVersion{
+						Version: "PostgreSQL 9.4.9",
+					},
+				}
+				mockSettings(expected.Settings, mocks)
+				mockDatabases(expected.Databases, mocks)
+				err := mockRoles(expected.Roles, mocks)
+				Expect(err).NotTo(HaveOccurred())
+				mockPostgreSQLVersion(expected.Version, mocks)
+				result, err := pg.GetDataWithOptions(helpers.PGDataOptions{TableChecksums: true})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mocks["db1super"].ExpectationsWereMet()).To(Succeed())
+				Expect(result).To(Equal(expected))
+			})
 			It("Correctly converts date to postgres date", func() {
 				input := "May 5 12:00:00 2017 +1"
 				expected := "2017-05-05 11:00:00"
@@ -814,29 +1059,26 @@ var _ = Describe("Postgres", func() {
 				db, mock, err = sqlmock.New()
 				Expect(err).NotTo(HaveOccurred())
 				pg = &helpers.PGData{
-					Data: helpers.PGCommon{},
-					DBs: []helpers.PGConn{
-						helpers.PGConn{DB: db, TargetDB: "db1"},
-					},
+					Data:  helpers.PGCommon{},
+					Conns: helpers.NewPGConnRegistry(),
 				}
+				pg.AddConnection("db1", pg.Data.DefUser, db)
 				prepared = `COPY "pgats_table_0" ("column0") FROM STDIN`
 				prepared = strings.Replace(prepared, ")", "\\)", -1)
 				prepared = strings.Replace(prepared, "(", "\\(", -1)
 			})
 			AfterEach(func() {
-				for _, conn := range pg.DBs {
-					conn.DB.Close()
-				}
+				pg.CloseConnections()
 			})
 			It("Correctly create and drop the table", func() {
-				mock.ExpectExec("CREATE TABLE pgats_table_0").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("CREATE INDEX pgats_table_0_index ON pgats_table_0 USING hash").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE TABLE "pgats_table_0"`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE INDEX "pgats_table_0_index" ON "pgats_table_0" USING hash`).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectBegin()
 				mock.ExpectPrepare(prepared)
 				mock.ExpectExec(prepared).WithArgs("short_string0").WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectExec("").WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
-				mock.ExpectExec("DROP TABLE pgats_table_0").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`DROP TABLE "pgats_table_0"`).WillReturnResult(sqlmock.NewResult(1, 1))
 
 				err := pg.CreateAndPopulateTablesWithPrefix("db1", helpers.Test1Load, "pgats_table")
 				Expect(err).NotTo(HaveOccurred())
@@ -846,23 +1088,23 @@ var _ = Describe("Postgres", func() {
 				Expect(mock.ExpectationsWereMet()).NotTo(HaveOccurred())
 			})
 			It("Fails to create the table", func() {
-				mock.ExpectExec("CREATE TABLE pgats_table_0").WillReturnError(genericError)
+				mock.ExpectExec(`CREATE TABLE "pgats_table_0"`).WillReturnError(genericError)
 
 				err := pg.CreateAndPopulateTables("db1", helpers.Test1Load)
 				Expect(err).To(MatchError(genericError))
 				Expect(mock.ExpectationsWereMet()).NotTo(HaveOccurred())
 			})
 			It("Fails to create the index", func() {
-				mock.ExpectExec("CREATE TABLE pgats_table_0").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("CREATE INDEX pgats_table_0_index ON pgats_table_0 USING hash").WillReturnError(genericError)
+				mock.ExpectExec(`CREATE TABLE "pgats_table_0"`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE INDEX "pgats_table_0_index" ON "pgats_table_0" USING hash`).WillReturnError(genericError)
 
 				err := pg.CreateAndPopulateTables("db1", helpers.Test1Load)
 				Expect(err).To(MatchError(genericError))
 				Expect(mock.ExpectationsWereMet()).NotTo(HaveOccurred())
 			})
 			It("Fails to begin the connection", func() {
-				mock.ExpectExec("CREATE TABLE pgats_table_0").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("CREATE INDEX pgats_table_0_index ON pgats_table_0 USING hash").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE TABLE "pgats_table_0"`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE INDEX "pgats_table_0_index" ON "pgats_table_0" USING hash`).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectBegin().WillReturnError(genericError)
 
 				err := pg.CreateAndPopulateTables("db1", helpers.Test1Load)
@@ -870,8 +1112,8 @@ var _ = Describe("Postgres", func() {
 				Expect(mock.ExpectationsWereMet()).NotTo(HaveOccurred())
 			})
 			It("Fails to prepare the statement", func() {
-				mock.ExpectExec("CREATE TABLE pgats_table_0").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("CREATE INDEX pgats_table_0_index ON pgats_table_0 USING hash").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE TABLE "pgats_table_0"`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE INDEX "pgats_table_0_index" ON "pgats_table_0" USING hash`).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectBegin()
 				mock.ExpectPrepare(prepared).WillReturnError(genericError)
 
@@ -880,8 +1122,8 @@ var _ = Describe("Postgres", func() {
 				Expect(mock.ExpectationsWereMet()).NotTo(HaveOccurred())
 			})
 			It("Fails to populate row", func() {
-				mock.ExpectExec("CREATE TABLE pgats_table_0").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("CREATE INDEX pgats_table_0_index ON pgats_table_0 USING hash").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE TABLE "pgats_table_0"`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE INDEX "pgats_table_0_index" ON "pgats_table_0" USING hash`).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectBegin()
 				mock.ExpectPrepare(prepared)
 				mock.ExpectExec(prepared).WithArgs("short_string0").WillReturnError(genericError)
@@ -891,8 +1133,8 @@ var _ = Describe("Postgres", func() {
 				Expect(mock.ExpectationsWereMet()).NotTo(HaveOccurred())
 			})
 			It("Fails to flush buffered data", func() {
-				mock.ExpectExec("CREATE TABLE pgats_table_0").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("CREATE INDEX pgats_table_0_index ON pgats_table_0 USING hash").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE TABLE "pgats_table_0"`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE INDEX "pgats_table_0_index" ON "pgats_table_0" USING hash`).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectBegin()
 				mock.ExpectPrepare(prepared)
 				mock.ExpectExec(prepared).WithArgs("short_string0").WillReturnResult(sqlmock.NewResult(1, 1))
@@ -903,8 +1145,8 @@ var _ = Describe("Postgres", func() {
 				Expect(mock.ExpectationsWereMet()).NotTo(HaveOccurred())
 			})
 			It("Fails to commit", func() {
-				mock.ExpectExec("CREATE TABLE pgats_table_0").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("CREATE INDEX pgats_table_0_index ON pgats_table_0 USING hash").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE TABLE "pgats_table_0"`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`CREATE INDEX "pgats_table_0_index" ON "pgats_table_0" USING hash`).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectBegin()
 				mock.ExpectPrepare(prepared)
 				mock.ExpectExec(prepared).WithArgs("short_string0").WillReturnResult(sqlmock.NewResult(1, 1))
@@ -0,0 +1,140 @@
+package helpers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// sslRequestCode is the protocol code of the SSLRequest message.
+const sslRequestCode = 80877103
+
+const SSLRefusedErr = "Server refused the SSL request"
+const SSLUnexpectedResponseErr = "Unexpected response %q to the SSL request"
+const NoServerCertificateErr = "Server presented no certificate"
+
+// PGTLSInfo describes the TLS session negotiated with the server and the
+// certificate it presented.
+type PGTLSInfo struct {
+	Subject     string
+	Issuer      string
+	DNSNames    []string
+	IPAddresses []string
+	KeyType     string
+	NotBefore   time.Time
+	NotAfter    time.Time
+	TLSVersion  string
+	CipherSuite string
+	// Chain is the certificate chain as presented, leaf first.
+	Chain []*x509.Certificate
+}
+
+// SANs returns the DNS names and IP addresses of the leaf certificate.
+func (i PGTLSInfo) SANs() []string {
+	return append(append([]string{}, i.DNSNames...), i.IPAddresses...)
+}
+
+// InspectServerTLS negotiates TLS with the server the way libpq does, but
+// without verifying the certificate or logging in, and reports what the
+// server presented. With direct set the TLS handshake starts right away, as
+// sslnegotiation=direct does on PostgreSQL 17 and later.
+func InspectServerTLS(ctx context.Context, address string, port int, direct bool) (PGTLSInfo, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return PGTLSInfo{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	config := &tls.Config{
+		// The point is to look at the certificate, not to trust it.
+		InsecureSkipVerify: true,
+		ServerName:         address,
+	}
+	if direct {
+		config.NextProtos = []string{"postgresql"}
+	} else if err := sendSSLRequest(conn); err != nil {
+		return PGTLSInfo{}, err
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return PGTLSInfo{}, err
+	}
+	return newPGTLSInfo(tlsConn.ConnectionState())
+}
+
+// InspectServerTLSContext inspects the server pg connects to, honouring its
+// sslnegotiation setting.
+func (pg PGData) InspectServerTLSContext(ctx context.Context) (PGTLSInfo, error) {
+	ctx, cancel := withTimeout(ctx, pg.Data.QueryTimeout)
+	defer cancel()
+	return InspectServerTLS(ctx, pg.Data.Address, pg.Data.Port, pg.Data.SSLNegotiation == "direct")
+}
+
+func sendSSLRequest(conn net.Conn) error {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], sslRequestCode)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	response := make([]byte, 1)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return err
+	}
+	switch response[0] {
+	case 'S':
+		return nil
+	case 'N':
+		return errors.New(SSLRefusedErr)
+	}
+	return fmt.Errorf(SSLUnexpectedResponseErr, response[0])
+}
+
+func newPGTLSInfo(state tls.ConnectionState) (PGTLSInfo, error) {
+	if len(state.PeerCertificates) == 0 {
+		return PGTLSInfo{}, errors.New(NoServerCertificateErr)
+	}
+	leaf := state.PeerCertificates[0]
+	info := PGTLSInfo{
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		DNSNames:    leaf.DNSNames,
+		KeyType:     publicKeyType(leaf.PublicKey),
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+		TLSVersion:  tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		Chain:       state.PeerCertificates,
+	}
+	for _, ip := range leaf.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info, nil
+}
+
+func publicKeyType(key interface{}) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return fmt.Sprintf("%T", key)
+}
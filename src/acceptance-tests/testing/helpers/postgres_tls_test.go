@@ -0,0 +1,119 @@
+package helpers_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeTLSServer answers a single connection like a PostgreSQL server: it
+// reads the SSLRequest, replies with response and, on 'S', starts TLS. With
+// direct set it starts TLS straight away.
+func fakeTLSServer(cert tls.Certificate, response byte, direct bool) (string, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(listener.Close)
+	go func() {
+		defer GinkgoRecover()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		config := &tls.Config{Certificates: []tls.Certificate{cert}}
+		if direct {
+			config.NextProtos = []string{"postgresql"}
+		} else {
+			request := make([]byte, 8)
+			_, err = io.ReadFull(conn, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binary.BigEndian.Uint32(request[4:])).To(Equal(uint32(80877103)))
+			conn.Write([]byte{response})
+			if response != 'S' {
+				return
+			}
+		}
+		tls.Server(conn, config).Handshake()
+	}()
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	Expect(err).NotTo(HaveOccurred())
+	portNum, err := strconv.Atoi(port)
+	Expect(err).NotTo(HaveOccurred())
+	return host, portNum
+}
+
+var _ = Describe("TLS inspector", func() {
+	var (
+		cert     tls.Certificate
+		notAfter time.Time
+	)
+
+	BeforeEach(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		notAfter = time.Now().Add(24 * time.Hour).Truncate(time.Second).UTC()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "10.0.0.5"},
+			Issuer:       pkix.Name{CommonName: "10.0.0.5"},
+			DNSNames:     []string{"q-s0.postgres.default.deployment.bosh"},
+			IPAddresses:  []net.IP{net.ParseIP("10.0.0.5")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     notAfter,
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		cert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	})
+
+	It("Reports the certificate and session negotiated after an SSLRequest", func() {
+		host, port := fakeTLSServer(cert, 'S', false)
+		info, err := helpers.InspectServerTLS(context.Background(), host, port, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Subject).To(Equal("CN=10.0.0.5"))
+		Expect(info.Issuer).To(Equal("CN=10.0.0.5"))
+		Expect(info.SANs()).To(Equal([]string{"q-s0.postgres.default.deployment.bosh", "10.0.0.5"}))
+		Expect(info.KeyType).To(Equal("ECDSA P-256"))
+		Expect(info.NotAfter).To(Equal(notAfter))
+		Expect(info.TLSVersion).To(Equal("TLS 1.3"))
+		Expect(info.CipherSuite).To(HavePrefix("TLS_"))
+		Expect(info.Chain).To(HaveLen(1))
+	})
+
+	It("Negotiates TLS directly", func() {
+		host, port := fakeTLSServer(cert, 0, true)
+		pg := helpers.PGData{Data: helpers.PGCommon{Address: host, Port: port, SSLNegotiation: "direct", QueryTimeout: 5 * time.Second}}
+		info, err := pg.InspectServerTLSContext(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Subject).To(Equal("CN=10.0.0.5"))
+	})
+
+	It("Fails if the server does not support SSL", func() {
+		host, port := fakeTLSServer(cert, 'N', false)
+		_, err := helpers.InspectServerTLS(context.Background(), host, port, false)
+		Expect(err).To(MatchError(helpers.SSLRefusedErr))
+	})
+
+	It("Fails on an unexpected response", func() {
+		host, port := fakeTLSServer(cert, 'E', false)
+		_, err := helpers.InspectServerTLS(context.Background(), host, port, false)
+		Expect(err).To(MatchError(ContainSubstring("Unexpected response 'E'")))
+	})
+})
@@ -0,0 +1,148 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const InvalidPostgreSQLVersionErr = "%q is not a PostgreSQL version"
+
+// PGVersionNumber is a PostgreSQL version such as 9.6.24 or 16.6. Up to 9.6
+// the major version is made of the first two numbers; from 10 on it is the
+// first one alone.
+type PGVersionNumber struct {
+	Numbers []int
+	// Suffix is what follows the numbers, such as beta1 or devel.
+	Suffix string
+}
+
+// ParsePGVersion reads a version given alone, as "16.6", as in versions.yml,
+// as "PostgreSQL 16.6", or in the output of version(), as
+// "PostgreSQL 16.6 (Debian 16.6-1) on x86_64-pc-linux-gnu, compiled by ...".
+func ParsePGVersion(version string) (PGVersionNumber, error) {
+	fields := strings.Fields(version)
+	if len(fields) > 1 && fields[0] == "PostgreSQL" {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return PGVersionNumber{}, fmt.Errorf(InvalidPostgreSQLVersionErr, version)
+	}
+	text := strings.TrimSuffix(fields[0], ",")
+	end := strings.IndexFunc(text, func(r rune) bool { return r != '.' && (r < '0' || r > '9') })
+	if end < 0 {
+		end = len(text)
+	}
+
+	var result PGVersionNumber
+	for _, part := range strings.Split(text[:end], ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return PGVersionNumber{}, fmt.Errorf(InvalidPostgreSQLVersionErr, version)
+		}
+		result.Numbers = append(result.Numbers, number)
+	}
+	result.Suffix = text[end:]
+	return result, nil
+}
+
+// mustParsePGVersion is ParsePGVersion for versions written in the code.
+func mustParsePGVersion(version string) PGVersionNumber {
+	result, err := ParsePGVersion(version)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// PGVersionFromNum reads a version given the way server_version_num is,
+// 90624 for 9.6.24 and 160006 for 16.6.
+func PGVersionFromNum(versionNum int) PGVersionNumber {
+	if versionNum < 100000 {
+		return PGVersionNumber{Numbers: []int{versionNum / 10000, versionNum / 100 % 100, versionNum % 100}}
+	}
+	return PGVersionNumber{Numbers: []int{versionNum / 10000, versionNum % 10000}}
+}
+
+// Number parses the output of version().
+func (v PGVersion) Number() (PGVersionNumber, error) {
+	return ParsePGVersion(v.Version)
+}
+
+func (v PGVersionNumber) majorLen() int {
+	if len(v.Numbers) > 0 && v.Numbers[0] < 10 {
+		return 2
+	}
+	return 1
+}
+
+func (v PGVersionNumber) number(idx int) int {
+	if idx < len(v.Numbers) {
+		return v.Numbers[idx]
+	}
+	return 0
+}
+
+// Major returns the major version, as "9.6" or "16".
+func (v PGVersionNumber) Major() string {
+	parts := make([]string, v.majorLen())
+	for idx := range parts {
+		parts[idx] = strconv.Itoa(v.number(idx))
+	}
+	return strings.Join(parts, ".")
+}
+
+// Minor returns the minor release within the major version, 24 for 9.6.24
+// and 6 for 16.6.
+func (v PGVersionNumber) Minor() int {
+	return v.number(v.majorLen())
+}
+
+// VersionNum returns the version the way server_version_num does, 90624 for
+// 9.6.24 and 160006 for 16.6.
+func (v PGVersionNumber) VersionNum() int {
+	if v.majorLen() == 2 {
+		return v.number(0)*10000 + v.number(1)*100 + v.number(2)
+	}
+	return v.number(0)*10000 + v.number(1)
+}
+
+func (v PGVersionNumber) SameMajor(other PGVersionNumber) bool {
+	return v.Major() == other.Major()
+}
+
+// Compare returns -1, 0 or 1 as v is older, the same as or newer than other.
+// Suffixes are not compared.
+func (v PGVersionNumber) Compare(other PGVersionNumber) int {
+	a, b := v.VersionNum(), other.VersionNum()
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Matches reports whether v is the version expected names. Only the numbers
+// expected gives are compared, so 16 matches every 16.x but 16.1 does not
+// match 16.10.
+func (v PGVersionNumber) Matches(expected PGVersionNumber) bool {
+	if len(expected.Numbers) == 0 || len(expected.Numbers) > len(v.Numbers) {
+		return false
+	}
+	for idx, number := range expected.Numbers {
+		if v.Numbers[idx] != number {
+			return false
+		}
+	}
+	return expected.Suffix == "" || expected.Suffix == v.Suffix
+}
+
+func (v PGVersionNumber) String() string {
+	parts := make([]string, len(v.Numbers))
+	for idx, number := range v.Numbers {
+		parts[idx] = strconv.Itoa(number)
+	}
+	return strings.Join(parts, ".") + v.Suffix
+}
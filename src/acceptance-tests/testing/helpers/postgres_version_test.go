@@ -0,0 +1,83 @@
+package helpers_test
+
+import (
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PostgreSQL versions", func() {
+	DescribeTable("Parsing versions",
+		func(input string, expected helpers.PGVersionNumber, major string, minor int, versionNum int) {
+			version, err := helpers.ParsePGVersion(input)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(expected))
+			Expect(version.Major()).To(Equal(major))
+			Expect(version.Minor()).To(Equal(minor))
+			Expect(version.VersionNum()).To(Equal(versionNum))
+		},
+		Entry("a number alone", "16.6", helpers.PGVersionNumber{Numbers: []int{16, 6}}, "16", 6, 160006),
+		Entry("from versions.yml", "PostgreSQL 16.6", helpers.PGVersionNumber{Numbers: []int{16, 6}}, "16", 6, 160006),
+		Entry("from version()", "PostgreSQL 16.6 on x86_64-pc-linux-gnu, compiled by gcc (Ubuntu 11.4.0-1ubuntu1~22.04) 11.4.0, 64-bit", helpers.PGVersionNumber{Numbers: []int{16, 6}}, "16", 6, 160006),
+		Entry("from a packaged version()", "PostgreSQL 15.10 (Debian 15.10-1.pgdg120+1) on aarch64-unknown-linux-gnu", helpers.PGVersionNumber{Numbers: []int{15, 10}}, "15", 10, 150010),
+		Entry("the 9.x scheme", "PostgreSQL 9.6.24", helpers.PGVersionNumber{Numbers: []int{9, 6, 24}}, "9.6", 24, 90624),
+		Entry("a 9.x version() output", "PostgreSQL 9.4.9 on x86_64-unknown-linux-gnu, compiled by gcc", helpers.PGVersionNumber{Numbers: []int{9, 4, 9}}, "9.4", 9, 90409),
+		Entry("a major version alone", "17", helpers.PGVersionNumber{Numbers: []int{17}}, "17", 0, 170000),
+		Entry("a beta", "PostgreSQL 18beta1 on x86_64-pc-linux-gnu", helpers.PGVersionNumber{Numbers: []int{18}, Suffix: "beta1"}, "18", 0, 180000),
+	)
+
+	DescribeTable("Rejecting what is not a version",
+		func(input string) {
+			_, err := helpers.ParsePGVersion(input)
+			Expect(err).To(MatchError(ContainSubstring("is not a PostgreSQL version")))
+		},
+		Entry("an empty string", ""),
+		Entry("a word", "wrong value"),
+		Entry("the product name alone", "PostgreSQL"),
+		Entry("an empty number", "16..1"),
+	)
+
+	DescribeTable("Matching an expected version",
+		func(actual string, expected string, matches bool) {
+			actualVersion, err := helpers.ParsePGVersion(actual)
+			Expect(err).NotTo(HaveOccurred())
+			expectedVersion, err := helpers.ParsePGVersion(expected)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actualVersion.Matches(expectedVersion)).To(Equal(matches))
+		},
+		Entry("the same version", "PostgreSQL 16.6 on x86_64-pc-linux-gnu", "PostgreSQL 16.6", true),
+		Entry("a prefix that is another version", "PostgreSQL 16.10", "PostgreSQL 16.1", false),
+		Entry("the major version", "PostgreSQL 16.10", "16", true),
+		Entry("another major version", "PostgreSQL 15.10", "16", false),
+		Entry("a 9.x major version", "PostgreSQL 9.6.24", "9.6", true),
+		Entry("a more precise version", "16", "16.6", false),
+	)
+
+	DescribeTable("Comparing versions across numbering schemes",
+		func(a string, b string, compare int, sameMajor bool) {
+			versionA, err := helpers.ParsePGVersion(a)
+			Expect(err).NotTo(HaveOccurred())
+			versionB, err := helpers.ParsePGVersion(b)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versionA.Compare(versionB)).To(Equal(compare))
+			Expect(versionA.SameMajor(versionB)).To(Equal(sameMajor))
+		},
+		Entry("minor releases of 16", "16.2", "16.10", -1, true),
+		Entry("minor releases of 9.6", "9.6.24", "9.6.3", 1, true),
+		Entry("9.6 and 9.5", "9.6.1", "9.5.20", 1, false),
+		Entry("9.6 and 10", "9.6.24", "10.1", -1, false),
+		Entry("the same version", "15.4", "PostgreSQL 15.4", 0, true),
+	)
+
+	DescribeTable("Reading server_version_num",
+		func(versionNum int, expected string) {
+			version := helpers.PGVersionFromNum(versionNum)
+			Expect(version.String()).To(Equal(expected))
+			Expect(version.VersionNum()).To(Equal(versionNum))
+		},
+		Entry("the 9.x scheme", 90624, "9.6.24"),
+		Entry("a minor release", 160006, "16.6"),
+		Entry("the first release of a major", 170000, "17.0"),
+	)
+})
@@ -15,6 +15,7 @@ type PgProperties struct {
 	MonitTimeout          int                   `yaml:"monit_timeout,omitempty"`
 	AdditionalConfig      PgAdditionalConfigMap `yaml:"additional_config,omitempty"`
 	TLS                   PgTLS                 `yaml:"tls,omitempty"`
+	TrustLocalConnections *bool                 `yaml:"trust_local_connections,omitempty"`
 }
 
 type PgDBProperties struct {
@@ -25,6 +26,7 @@ type PgDBProperties struct {
 type PgRoleProperties struct {
 	Name        string   `yaml:"name"`
 	Password    string   `yaml:"password"`
+	CommonName  string   `yaml:"common_name,omitempty"`
 	Permissions []string `yaml:"permissions,omitempty"`
 }
 
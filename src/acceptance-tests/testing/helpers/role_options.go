@@ -0,0 +1,250 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const UnexpectedRoleOptionErr = "unexpected %s"
+const MissingRoleOptionValueErr = "%s must be followed by %s"
+const RedundantRoleOptionErr = "conflicting or redundant option %s"
+const UnterminatedRoleOptionErr = "unterminated %s"
+const UnsupportedRoleOptionErr = "%s is not allowed in ALTER ROLE, which the release applies the permissions with"
+
+// PGRoleOptions is the state a role is expected to be in once the release
+// has run CREATE ROLE ... WITH LOGIN followed by ALTER ROLE ... WITH the
+// role permissions.
+type PGRoleOptions struct {
+	// Role holds the expected attributes. Its Name and ValidUntil are not
+	// set: VALID UNTIL is kept as written in ValidUntil.
+	Role       PGRole
+	ValidUntil string
+	// Password is nil when the permissions do not set a password and points
+	// to "" for PASSWORD NULL.
+	Password *string
+}
+
+// roleOptionToken is a keyword or unquoted identifier, a quoted identifier,
+// a string constant, a number or a comma.
+type roleOptionToken struct {
+	text string
+	kind byte // 'w' word, 'i' quoted identifier, 's' string, 'n' number, ','
+}
+
+func (t roleOptionToken) String() string {
+	switch t.kind {
+	case 'i':
+		return strconv.Quote(t.text)
+	case 's':
+		return "'" + t.text + "'"
+	}
+	return t.text
+}
+
+// ParseRoleOptions parses the options of ALTER ROLE given in permissions.
+// The elements are joined with spaces, as the release does, so an option may
+// span several of them. The options only CREATE ROLE takes, IN ROLE, ROLE,
+// ADMIN and SYSID, are refused since the release could not apply them.
+func ParseRoleOptions(permissions []string) (PGRoleOptions, error) {
+	result := PGRoleOptions{
+		Role: PGRole{
+			Inherit:   true,
+			CanLogin:  true,
+			ConnLimit: -1,
+		},
+	}
+	tokens, err := tokenizeRoleOptions(strings.Join(permissions, " "))
+	if err != nil {
+		return PGRoleOptions{}, err
+	}
+	flags := map[string]*bool{
+		"SUPERUSER":   &result.Role.Super,
+		"CREATEDB":    &result.Role.CreateDb,
+		"CREATEROLE":  &result.Role.CreateRole,
+		"INHERIT":     &result.Role.Inherit,
+		"LOGIN":       &result.Role.CanLogin,
+		"REPLICATION": &result.Role.Replication,
+		"BYPASSRLS":   &result.Role.BypassRLS,
+	}
+	seen := make(map[string]bool)
+	setOnce := func(option string) error {
+		if seen[option] {
+			return fmt.Errorf(RedundantRoleOptionErr, option)
+		}
+		seen[option] = true
+		return nil
+	}
+
+	p := &roleOptionParser{tokens: tokens}
+	for !p.done() {
+		token := p.next()
+		if token.kind != 'w' {
+			return PGRoleOptions{}, fmt.Errorf(UnexpectedRoleOptionErr, token)
+		}
+		keyword := strings.ToUpper(token.text)
+		if flag, ok := flags[keyword]; ok {
+			if err := setOnce(keyword); err != nil {
+				return PGRoleOptions{}, err
+			}
+			*flag = true
+			continue
+		}
+		if flag, ok := flags[strings.TrimPrefix(keyword, "NO")]; ok && strings.HasPrefix(keyword, "NO") {
+			if err := setOnce(strings.TrimPrefix(keyword, "NO")); err != nil {
+				return PGRoleOptions{}, err
+			}
+			*flag = false
+			continue
+		}
+
+		switch keyword {
+		case "CONNECTION":
+			if err := p.expectWord("LIMIT", "CONNECTION"); err != nil {
+				return PGRoleOptions{}, err
+			}
+			if err := setOnce("CONNECTION LIMIT"); err != nil {
+				return PGRoleOptions{}, err
+			}
+			value, err := p.expect('n', "a number", "CONNECTION LIMIT")
+			if err != nil {
+				return PGRoleOptions{}, err
+			}
+			result.Role.ConnLimit, err = strconv.Atoi(value)
+			if err != nil {
+				return PGRoleOptions{}, err
+			}
+		case "ENCRYPTED", "PASSWORD":
+			if keyword == "ENCRYPTED" {
+				if err := p.expectWord("PASSWORD", "ENCRYPTED"); err != nil {
+					return PGRoleOptions{}, err
+				}
+			}
+			if err := setOnce("PASSWORD"); err != nil {
+				return PGRoleOptions{}, err
+			}
+			if p.peekWord("NULL") {
+				p.next()
+				result.Password = new(string)
+				continue
+			}
+			value, err := p.expect('s', "a string or NULL", "PASSWORD")
+			if err != nil {
+				return PGRoleOptions{}, err
+			}
+			result.Password = &value
+		case "VALID":
+			if err := p.expectWord("UNTIL", "VALID"); err != nil {
+				return PGRoleOptions{}, err
+			}
+			if err := setOnce("VALID UNTIL"); err != nil {
+				return PGRoleOptions{}, err
+			}
+			result.ValidUntil, err = p.expect('s', "a string", "VALID UNTIL")
+			if err != nil {
+				return PGRoleOptions{}, err
+			}
+		case "IN":
+			if !p.peekWord("ROLE") && !p.peekWord("GROUP") {
+				return PGRoleOptions{}, fmt.Errorf(MissingRoleOptionValueErr, "IN", "ROLE or GROUP")
+			}
+			return PGRoleOptions{}, fmt.Errorf(UnsupportedRoleOptionErr, "IN "+strings.ToUpper(p.next().text))
+		case "ROLE", "USER", "ADMIN", "SYSID":
+			return PGRoleOptions{}, fmt.Errorf(UnsupportedRoleOptionErr, keyword)
+		default:
+			return PGRoleOptions{}, fmt.Errorf(UnexpectedRoleOptionErr, token)
+		}
+	}
+	return result, nil
+}
+
+type roleOptionParser struct {
+	tokens []roleOptionToken
+	pos    int
+}
+
+func (p *roleOptionParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *roleOptionParser) next() roleOptionToken {
+	token := p.tokens[p.pos]
+	p.pos++
+	return token
+}
+
+func (p *roleOptionParser) peekWord(word string) bool {
+	return !p.done() && p.tokens[p.pos].kind == 'w' && strings.EqualFold(p.tokens[p.pos].text, word)
+}
+
+func (p *roleOptionParser) expectWord(word, after string) error {
+	if !p.peekWord(word) {
+		return fmt.Errorf(MissingRoleOptionValueErr, after, word)
+	}
+	p.next()
+	return nil
+}
+
+func (p *roleOptionParser) expect(kind byte, what, after string) (string, error) {
+	if p.done() || p.tokens[p.pos].kind != kind {
+		return "", fmt.Errorf(MissingRoleOptionValueErr, after, what)
+	}
+	return p.next().text, nil
+}
+
+func tokenizeRoleOptions(input string) ([]roleOptionToken, error) {
+	var result []roleOptionToken
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == ',':
+			result = append(result, roleOptionToken{text: ",", kind: ','})
+			i++
+		case r == '\'' || r == '"':
+			var b strings.Builder
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						b.WriteRune(r)
+						i++
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				b.WriteRune(runes[i])
+			}
+			if !closed {
+				if r == '"' {
+					return nil, fmt.Errorf(UnterminatedRoleOptionErr, "quoted identifier")
+				}
+				return nil, fmt.Errorf(UnterminatedRoleOptionErr, "string")
+			}
+			kind := byte('s')
+			if r == '"' {
+				kind = 'i'
+			}
+			result = append(result, roleOptionToken{text: b.String(), kind: kind})
+		case r == '-' || unicode.IsDigit(r):
+			start := i
+			for i++; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+			}
+			if runes[i-1] == '-' {
+				return nil, fmt.Errorf(UnexpectedRoleOptionErr, "-")
+			}
+			result = append(result, roleOptionToken{text: string(runes[start:i]), kind: 'n'})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i++; i < len(runes) && (runes[i] == '_' || runes[i] == '$' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])); i++ {
+			}
+			result = append(result, roleOptionToken{text: string(runes[start:i]), kind: 'w'})
+		default:
+			return nil, fmt.Errorf(UnexpectedRoleOptionErr, strconv.QuoteRune(r))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package helpers_test
+
+import (
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Role options", func() {
+	defaultRole := func() helpers.PGRole {
+		return helpers.PGRole{Inherit: true, CanLogin: true, ConnLimit: -1}
+	}
+
+	It("Expects a plain login role without permissions", func() {
+		options, err := helpers.ParseRoleOptions(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options).To(Equal(helpers.PGRoleOptions{Role: defaultRole()}))
+	})
+
+	DescribeTable("Parsing role attributes",
+		func(permissions []string, update func(*helpers.PGRole)) {
+			expected := defaultRole()
+			update(&expected)
+			options, err := helpers.ParseRoleOptions(permissions)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(options.Role).To(Equal(expected))
+		},
+		Entry("every attribute", []string{"SUPERUSER", "CREATEDB", "CREATEROLE", "NOINHERIT", "NOLOGIN", "REPLICATION", "BYPASSRLS"}, func(r *helpers.PGRole) {
+			r.Super, r.CreateDb, r.CreateRole, r.Inherit, r.CanLogin, r.Replication, r.BypassRLS = true, true, true, false, false, true, true
+		}),
+		Entry("negated attributes", []string{"NOSUPERUSER", "NOCREATEDB", "NOCREATEROLE", "INHERIT", "LOGIN", "NOREPLICATION", "NOBYPASSRLS"}, func(r *helpers.PGRole) {}),
+		Entry("lowercase keywords", []string{"createdb", "NoLogin"}, func(r *helpers.PGRole) {
+			r.CreateDb, r.CanLogin = true, false
+		}),
+		Entry("several options in one element", []string{"CREATEDB CONNECTION LIMIT 5"}, func(r *helpers.PGRole) {
+			r.CreateDb, r.ConnLimit = true, 5
+		}),
+		Entry("an option spanning elements", []string{"CONNECTION", "LIMIT", "-1"}, func(r *helpers.PGRole) {}),
+	)
+
+	It("Records passwords and expiry", func() {
+		options, err := helpers.ParseRoleOptions([]string{
+			"ENCRYPTED PASSWORD 'it''s secret'",
+			"VALID UNTIL 'infinity'",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*options.Password).To(Equal("it's secret"))
+		Expect(options.ValidUntil).To(Equal("infinity"))
+	})
+
+	It("Records PASSWORD NULL as an empty password", func() {
+		options, err := helpers.ParseRoleOptions([]string{"password null"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(options.Password).NotTo(BeNil())
+		Expect(*options.Password).To(BeEmpty())
+	})
+
+	DescribeTable("Rejecting what PostgreSQL would reject",
+		func(permissions []string, expected string) {
+			_, err := helpers.ParseRoleOptions(permissions)
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("an unknown keyword", []string{"CREATEDB", "SUPERDUPER"}, "unexpected SUPERDUPER"),
+		Entry("a misspelt multi-word option", []string{"CONNECTION LIMITS 3"}, "CONNECTION must be followed by LIMIT"),
+		Entry("a missing value", []string{"CONNECTION LIMIT"}, "CONNECTION LIMIT must be followed by a number"),
+		Entry("an unquoted password", []string{"PASSWORD secret"}, "PASSWORD must be followed by a string or NULL"),
+		Entry("an unquoted expiry", []string{"VALID UNTIL 2030"}, "VALID UNTIL must be followed by a string"),
+		Entry("IN without ROLE", []string{"IN pg_monitor"}, "IN must be followed by ROLE or GROUP"),
+		Entry("IN ROLE", []string{`IN ROLE pg_monitor, "Auditors"`}, "IN ROLE is not allowed in ALTER ROLE, which the release applies the permissions with"),
+		Entry("IN GROUP", []string{"in group pg_monitor"}, "IN GROUP is not allowed in ALTER ROLE, which the release applies the permissions with"),
+		Entry("ROLE", []string{"ROLE Alice"}, "ROLE is not allowed in ALTER ROLE, which the release applies the permissions with"),
+		Entry("USER", []string{"user alice"}, "USER is not allowed in ALTER ROLE, which the release applies the permissions with"),
+		Entry("ADMIN", []string{"ADMIN bob, carol"}, "ADMIN is not allowed in ALTER ROLE, which the release applies the permissions with"),
+		Entry("SYSID", []string{"SYSID 42"}, "SYSID is not allowed in ALTER ROLE, which the release applies the permissions with"),
+		Entry("a redundant option", []string{"CREATEDB", "NOCREATEDB"}, "conflicting or redundant option CREATEDB"),
+		Entry("an unterminated string", []string{"PASSWORD 'abc"}, "unterminated string"),
+		Entry("a stray string", []string{"'CREATEDB'"}, "unexpected 'CREATEDB'"),
+		Entry("a stray character", []string{"CREATEDB;"}, `unexpected ';'`),
+	)
+})
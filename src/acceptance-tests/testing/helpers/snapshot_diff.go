@@ -0,0 +1,271 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PGDataDiff is the set of changes between two PGOutputData snapshots.
+// Objects are named as "database", "database: schema.table",
+// "database: schema.table.column" and "database: extension".
+type PGDataDiff struct {
+	AddedDatabases    []string           `json:"added_databases,omitempty"`
+	RemovedDatabases  []string           `json:"removed_databases,omitempty"`
+	AddedTables       []string           `json:"added_tables,omitempty"`
+	RemovedTables     []string           `json:"removed_tables,omitempty"`
+	AddedColumns      []string           `json:"added_columns,omitempty"`
+	RemovedColumns    []string           `json:"removed_columns,omitempty"`
+	ChangedColumns    []PGValueChange    `json:"changed_columns,omitempty"`
+	AddedExtensions   []string           `json:"added_extensions,omitempty"`
+	RemovedExtensions []string           `json:"removed_extensions,omitempty"`
+	ChangedExtensions []PGValueChange    `json:"changed_extensions,omitempty"`
+	AddedRoles        []string           `json:"added_roles,omitempty"`
+	RemovedRoles      []string           `json:"removed_roles,omitempty"`
+	AddedSettings     []string           `json:"added_settings,omitempty"`
+	RemovedSettings   []string           `json:"removed_settings,omitempty"`
+	ChangedSettings   []PGValueChange    `json:"changed_settings,omitempty"`
+	RowCountDeltas    []PGRowCountChange `json:"row_count_deltas,omitempty"`
+	ChangedOwners     []PGValueChange    `json:"changed_owners,omitempty"`
+	// ChangedChecksums lists the tables whose content checksum differs.
+	// Tables without a checksum on either side are not compared.
+	ChangedChecksums []PGValueChange `json:"changed_checksums,omitempty"`
+}
+
+type PGValueChange struct {
+	Object string `json:"object"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type PGRowCountChange struct {
+	Table  string `json:"table"`
+	Before int    `json:"before"`
+	After  int    `json:"after"`
+	Delta  int    `json:"delta"`
+}
+
+// DiffPGOutputData compares two snapshots and returns what changed going
+// from before to after.
+func DiffPGOutputData(before, after PGOutputData) PGDataDiff {
+	var diff PGDataDiff
+
+	beforeDBs := databasesByName(before.Databases)
+	afterDBs := databasesByName(after.Databases)
+	diff.AddedDatabases, diff.RemovedDatabases = diffKeys(beforeDBs, afterDBs)
+	for _, name := range sortedKeys(beforeDBs) {
+		afterDB, ok := afterDBs[name]
+		if !ok {
+			continue
+		}
+		diff.diffDatabase(beforeDBs[name], afterDB)
+	}
+
+	diff.AddedRoles, diff.RemovedRoles = diffKeys(before.Roles, after.Roles)
+	diff.AddedSettings, diff.RemovedSettings = diffKeys(before.Settings, after.Settings)
+
+	for _, key := range sortedKeys(before.Settings) {
+		value, ok := after.Settings[key]
+		if ok && value != before.Settings[key] {
+			diff.ChangedSettings = append(diff.ChangedSettings, PGValueChange{Object: key, Before: before.Settings[key], After: value})
+		}
+	}
+	return diff
+}
+
+// DiffTo returns the changes from the validator snapshot to data.
+func (v Validator) DiffTo(data PGOutputData) PGDataDiff {
+	return DiffPGOutputData(v.PostgresData, data)
+}
+
+func (d *PGDataDiff) diffDatabase(before, after PGDatabase) {
+	beforeExts := extensionsByName(before.DBExts)
+	afterExts := extensionsByName(after.DBExts)
+	added, removed := diffKeys(beforeExts, afterExts)
+	d.AddedExtensions = append(d.AddedExtensions, prefixAll(before.Name+": ", added)...)
+	d.RemovedExtensions = append(d.RemovedExtensions, prefixAll(before.Name+": ", removed)...)
+	for _, name := range sortedKeys(beforeExts) {
+		afterExt, ok := afterExts[name]
+		if ok && beforeExts[name].Version != afterExt.Version {
+			d.ChangedExtensions = append(d.ChangedExtensions, PGValueChange{Object: before.Name + ": " + name, Before: beforeExts[name].Version, After: afterExt.Version})
+		}
+	}
+
+	beforeTables := tablesByName(before.Tables)
+	afterTables := tablesByName(after.Tables)
+	added, removed = diffKeys(beforeTables, afterTables)
+	d.AddedTables = append(d.AddedTables, prefixAll(before.Name+": ", added)...)
+	d.RemovedTables = append(d.RemovedTables, prefixAll(before.Name+": ", removed)...)
+	for _, name := range sortedKeys(beforeTables) {
+		afterTable, ok := afterTables[name]
+		if !ok {
+			continue
+		}
+		d.diffTable(before.Name+": "+name, beforeTables[name], afterTable)
+	}
+}
+
+func (d *PGDataDiff) diffTable(name string, before, after PGTable) {
+	if before.TableOwner != after.TableOwner {
+		d.ChangedOwners = append(d.ChangedOwners, PGValueChange{Object: name, Before: before.TableOwner, After: after.TableOwner})
+	}
+	if before.TableRowsCount.Num != after.TableRowsCount.Num {
+		d.RowCountDeltas = append(d.RowCountDeltas, PGRowCountChange{
+			Table:  name,
+			Before: before.TableRowsCount.Num,
+			After:  after.TableRowsCount.Num,
+			Delta:  after.TableRowsCount.Num - before.TableRowsCount.Num,
+		})
+	}
+	if before.Checksum != "" && after.Checksum != "" && before.Checksum != after.Checksum {
+		d.ChangedChecksums = append(d.ChangedChecksums, PGValueChange{Object: name, Before: before.Checksum, After: after.Checksum})
+	}
+
+	beforeCols := columnsByName(before.TableColumns)
+	afterCols := columnsByName(after.TableColumns)
+	added, removed := diffKeys(beforeCols, afterCols)
+	d.AddedColumns = append(d.AddedColumns, prefixAll(name+".", added)...)
+	d.RemovedColumns = append(d.RemovedColumns, prefixAll(name+".", removed)...)
+	for _, col := range sortedKeys(beforeCols) {
+		afterCol, ok := afterCols[col]
+		if !ok {
+			continue
+		}
+		if beforeCols[col] != afterCol {
+			d.ChangedColumns = append(d.ChangedColumns, PGValueChange{
+				Object: name + "." + col,
+				Before: columnDescription(beforeCols[col]),
+				After:  columnDescription(afterCol),
+			})
+		}
+	}
+}
+
+// IsEmpty reports whether the two snapshots are identical.
+func (d PGDataDiff) IsEmpty() bool {
+	return !d.TablesChanged() &&
+		len(d.AddedExtensions) == 0 && len(d.RemovedExtensions) == 0 && len(d.ChangedExtensions) == 0 &&
+		len(d.AddedRoles) == 0 && len(d.RemovedRoles) == 0 &&
+		len(d.AddedSettings) == 0 && len(d.RemovedSettings) == 0 && len(d.ChangedSettings) == 0 &&
+		len(d.ChangedChecksums) == 0
+}
+
+// TablesChanged reports whether any database, table, column, row count or
+// table owner differs between the two snapshots. Table contents are compared
+// with ChangedChecksums.
+func (d PGDataDiff) TablesChanged() bool {
+	return len(d.AddedDatabases) > 0 || len(d.RemovedDatabases) > 0 ||
+		len(d.AddedTables) > 0 || len(d.RemovedTables) > 0 ||
+		len(d.AddedColumns) > 0 || len(d.RemovedColumns) > 0 || len(d.ChangedColumns) > 0 ||
+		len(d.RowCountDeltas) > 0 || len(d.ChangedOwners) > 0
+}
+
+func (d PGDataDiff) String() string {
+	if d.IsEmpty() {
+		return "no changes"
+	}
+	var b strings.Builder
+	writeList := func(title string, items []string) {
+		for _, item := range items {
+			fmt.Fprintf(&b, "%s %s\n", title, item)
+		}
+	}
+	writeChanges := func(title string, changes []PGValueChange) {
+		for _, c := range changes {
+			fmt.Fprintf(&b, "%s %s: %q -> %q\n", title, c.Object, c.Before, c.After)
+		}
+	}
+	writeList("+ database", d.AddedDatabases)
+	writeList("- database", d.RemovedDatabases)
+	writeList("+ table", d.AddedTables)
+	writeList("- table", d.RemovedTables)
+	writeList("+ column", d.AddedColumns)
+	writeList("- column", d.RemovedColumns)
+	writeChanges("~ column", d.ChangedColumns)
+	writeList("+ extension", d.AddedExtensions)
+	writeList("- extension", d.RemovedExtensions)
+	writeChanges("~ extension", d.ChangedExtensions)
+	writeList("+ role", d.AddedRoles)
+	writeList("- role", d.RemovedRoles)
+	writeList("+ setting", d.AddedSettings)
+	writeList("- setting", d.RemovedSettings)
+	writeChanges("~ setting", d.ChangedSettings)
+	for _, c := range d.RowCountDeltas {
+		fmt.Fprintf(&b, "~ rows %s: %d -> %d (%+d)\n", c.Table, c.Before, c.After, c.Delta)
+	}
+	writeChanges("~ owner", d.ChangedOwners)
+	writeChanges("~ checksum", d.ChangedChecksums)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (d PGDataDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+func databasesByName(dbs []PGDatabase) map[string]PGDatabase {
+	result := make(map[string]PGDatabase)
+	for _, db := range dbs {
+		result[db.Name] = db
+	}
+	return result
+}
+
+func extensionsByName(exts []PGDatabaseExtensions) map[string]PGDatabaseExtensions {
+	result := make(map[string]PGDatabaseExtensions)
+	for _, ext := range exts {
+		result[ext.Name] = ext
+	}
+	return result
+}
+
+func tablesByName(tables []PGTable) map[string]PGTable {
+	result := make(map[string]PGTable)
+	for _, table := range tables {
+		result[table.SchemaName+"."+table.TableName] = table
+	}
+	return result
+}
+
+func columnsByName(cols []PGTableColumn) map[string]PGTableColumn {
+	result := make(map[string]PGTableColumn)
+	for _, col := range cols {
+		result[col.ColumnName] = col
+	}
+	return result
+}
+
+func columnDescription(col PGTableColumn) string {
+	return fmt.Sprintf("%s at position %d", col.DataType, col.Position)
+}
+
+func diffKeys[V any](before, after map[string]V) (added, removed []string) {
+	for _, key := range sortedKeys(after) {
+		if _, ok := before[key]; !ok {
+			added = append(added, key)
+		}
+	}
+	for _, key := range sortedKeys(before) {
+		if _, ok := after[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	return added, removed
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func prefixAll(prefix string, items []string) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, prefix+item)
+	}
+	return result
+}
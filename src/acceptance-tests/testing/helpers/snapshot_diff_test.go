@@ -0,0 +1,153 @@
+package helpers_test
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot diff", func() {
+	var before helpers.PGOutputData
+
+	BeforeEach(func() {
+		before = helpers.PGOutputData{
+			Roles: map[string]helpers.PGRole{
+				"pgadmin": {Name: "pgadmin", Super: true},
+				"olduser": {Name: "olduser"},
+			},
+			Databases: []helpers.PGDatabase{
+				{
+					Name:   "db1",
+					DBExts: []helpers.PGDatabaseExtensions{{Name: "plpgsql"}, {Name: "citext"}},
+					Tables: []helpers.PGTable{
+						{
+							SchemaName: "public",
+							TableName:  "t1",
+							TableOwner: "pgadmin",
+							TableColumns: []helpers.PGTableColumn{
+								{ColumnName: "id", DataType: "integer", Position: 1},
+								{ColumnName: "name", DataType: "text", Position: 2},
+							},
+							TableRowsCount: helpers.PGCount{Num: 10},
+						},
+						{SchemaName: "public", TableName: "t2", TableOwner: "pgadmin"},
+					},
+				},
+				{Name: "db2"},
+			},
+			Settings: map[string]string{"max_connections": "30", "port": "5432"},
+		}
+	})
+
+	It("Reports no changes for identical snapshots", func() {
+		after, err := before.CopyData()
+		Expect(err).NotTo(HaveOccurred())
+		diff := helpers.DiffPGOutputData(before, after)
+		Expect(diff.IsEmpty()).To(BeTrue())
+		Expect(diff.String()).To(Equal("no changes"))
+	})
+
+	It("Reports every kind of change", func() {
+		after, err := before.CopyData()
+		Expect(err).NotTo(HaveOccurred())
+		after.Databases = after.Databases[:1]
+		after.Databases = append(after.Databases, helpers.PGDatabase{Name: "db3"})
+		db1 := &after.Databases[0]
+		db1.DBExts = []helpers.PGDatabaseExtensions{{Name: "plpgsql"}, {Name: "pgcrypto"}}
+		db1.Tables = []helpers.PGTable{db1.Tables[0], {SchemaName: "public", TableName: "t3"}}
+		t1 := &db1.Tables[0]
+		t1.TableOwner = "newowner"
+		t1.TableRowsCount.Num = 7
+		t1.TableColumns = []helpers.PGTableColumn{
+			{ColumnName: "id", DataType: "bigint", Position: 1},
+			{ColumnName: "email", DataType: "text", Position: 3},
+		}
+		delete(after.Roles, "olduser")
+		after.Roles["newuser"] = helpers.PGRole{Name: "newuser"}
+		after.Settings["max_connections"] = "40"
+		after.Settings["wal_level"] = "replica"
+		delete(after.Settings, "port")
+
+		diff := helpers.DiffPGOutputData(before, after)
+		Expect(diff).To(Equal(helpers.PGDataDiff{
+			AddedDatabases:    []string{"db3"},
+			RemovedDatabases:  []string{"db2"},
+			AddedTables:       []string{"db1: public.t3"},
+			RemovedTables:     []string{"db1: public.t2"},
+			AddedColumns:      []string{"db1: public.t1.email"},
+			RemovedColumns:    []string{"db1: public.t1.name"},
+			ChangedColumns:    []helpers.PGValueChange{{Object: "db1: public.t1.id", Before: "integer at position 1", After: "bigint at position 1"}},
+			AddedExtensions:   []string{"db1: pgcrypto"},
+			RemovedExtensions: []string{"db1: citext"},
+			AddedRoles:        []string{"newuser"},
+			RemovedRoles:      []string{"olduser"},
+			AddedSettings:     []string{"wal_level"},
+			RemovedSettings:   []string{"port"},
+			ChangedSettings:   []helpers.PGValueChange{{Object: "max_connections", Before: "30", After: "40"}},
+			RowCountDeltas:    []helpers.PGRowCountChange{{Table: "db1: public.t1", Before: 10, After: 7, Delta: -3}},
+			ChangedOwners:     []helpers.PGValueChange{{Object: "db1: public.t1", Before: "pgadmin", After: "newowner"}},
+		}))
+		Expect(diff.TablesChanged()).To(BeTrue())
+		Expect(diff.String()).To(ContainSubstring("- database db2"))
+		Expect(diff.String()).To(ContainSubstring(`~ owner db1: public.t1: "pgadmin" -> "newowner"`))
+		Expect(diff.String()).To(ContainSubstring("~ rows db1: public.t1: 10 -> 7 (-3)"))
+		Expect(diff.String()).To(ContainSubstring("+ setting wal_level"))
+		Expect(diff.String()).To(ContainSubstring("- setting port"))
+	})
+
+	It("Reports the tables whose checksum changed", func() {
+		before.Databases[0].Tables[0].Checksum = "aaa"
+		after, err := before.CopyData()
+		Expect(err).NotTo(HaveOccurred())
+		after.Databases[0].Tables[0].Checksum = "bbb"
+		after.Databases[0].Tables[1].Checksum = "ccc"
+
+		diff := helpers.DiffPGOutputData(before, after)
+		Expect(diff.ChangedChecksums).To(Equal([]helpers.PGValueChange{{Object: "db1: public.t1", Before: "aaa", After: "bbb"}}))
+		Expect(diff.IsEmpty()).To(BeFalse())
+		Expect(diff.TablesChanged()).To(BeFalse())
+		Expect(diff.String()).To(Equal(`~ checksum db1: public.t1: "aaa" -> "bbb"`))
+	})
+
+	It("Does not report setting or role changes as table changes", func() {
+		after, err := before.CopyData()
+		Expect(err).NotTo(HaveOccurred())
+		after.Settings["max_connections"] = "40"
+		delete(after.Settings, "port")
+		delete(after.Roles, "olduser")
+
+		diff := helpers.DiffPGOutputData(before, after)
+		Expect(diff.IsEmpty()).To(BeFalse())
+		Expect(diff.TablesChanged()).To(BeFalse())
+	})
+
+	It("Reports extension version changes", func() {
+		after, err := before.CopyData()
+		Expect(err).NotTo(HaveOccurred())
+		before.Databases[0].DBExts[1].Version = "1.4"
+		after.Databases[0].DBExts[1].Version = "1.6"
+
+		diff := helpers.DiffPGOutputData(before, after)
+		Expect(diff.ChangedExtensions).To(Equal([]helpers.PGValueChange{{Object: "db1: citext", Before: "1.4", After: "1.6"}}))
+		Expect(diff.TablesChanged()).To(BeFalse())
+		Expect(diff.String()).To(Equal(`~ extension db1: citext: "1.4" -> "1.6"`))
+	})
+
+	It("Renders the change set as JSON", func() {
+		after, err := before.CopyData()
+		Expect(err).NotTo(HaveOccurred())
+		after.Databases[0].Tables[0].TableRowsCount.Num = 12
+
+		data, err := helpers.DiffPGOutputData(before, after).JSON()
+		Expect(err).NotTo(HaveOccurred())
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+		Expect(decoded).To(HaveLen(1))
+		Expect(decoded).To(HaveKeyWithValue("row_count_deltas", ConsistOf(map[string]interface{}{
+			"table": "db1: public.t1", "before": float64(10), "after": float64(12), "delta": float64(2),
+		})))
+	})
+})
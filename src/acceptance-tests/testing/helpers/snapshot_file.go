@@ -0,0 +1,89 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// PGSnapshotFormatVersion is bumped whenever the layout of a saved snapshot
+// changes in a way older readers cannot load.
+const PGSnapshotFormatVersion = 1
+
+const UnknownSnapshotFormatErr = "Unknown snapshot format for %s: use a .json, .yml or .yaml file"
+const UnsupportedSnapshotVersionErr = "Snapshot %s has format version %d, supported version is %d"
+
+// PGSnapshot is a PGOutputData saved to disk together with the versions of
+// the server and of the postgres-release that produced it.
+type PGSnapshot struct {
+	FormatVersion  int          `json:"format_version" yaml:"format_version"`
+	ReleaseVersion string       `json:"release_version" yaml:"release_version"`
+	ServerVersion  string       `json:"server_version" yaml:"server_version"`
+	Data           PGOutputData `json:"data" yaml:"data"`
+}
+
+func NewPGSnapshot(data PGOutputData, releaseVersion string) PGSnapshot {
+	return PGSnapshot{
+		FormatVersion:  PGSnapshotFormatVersion,
+		ReleaseVersion: releaseVersion,
+		ServerVersion:  data.Version.Version,
+		Data:           data,
+	}
+}
+
+// Save writes the snapshot to path as JSON or YAML depending on its extension.
+func (s PGSnapshot) Save(path string) error {
+	var bytes []byte
+	var err error
+	switch snapshotFormat(path) {
+	case "json":
+		bytes, err = json.MarshalIndent(s, "", "  ")
+	case "yaml":
+		bytes, err = yaml.Marshal(s)
+	default:
+		return fmt.Errorf(UnknownSnapshotFormatErr, path)
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0644)
+}
+
+// LoadPGSnapshot reads a snapshot written by Save.
+func LoadPGSnapshot(path string) (PGSnapshot, error) {
+	var snapshot PGSnapshot
+	format := snapshotFormat(path)
+	if format == "" {
+		return PGSnapshot{}, fmt.Errorf(UnknownSnapshotFormatErr, path)
+	}
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return PGSnapshot{}, err
+	}
+	if format == "json" {
+		err = json.Unmarshal(bytes, &snapshot)
+	} else {
+		err = yaml.Unmarshal(bytes, &snapshot)
+	}
+	if err != nil {
+		return PGSnapshot{}, err
+	}
+	if snapshot.FormatVersion < 1 || snapshot.FormatVersion > PGSnapshotFormatVersion {
+		return PGSnapshot{}, fmt.Errorf(UnsupportedSnapshotVersionErr, path, snapshot.FormatVersion, PGSnapshotFormatVersion)
+	}
+	return snapshot, nil
+}
+
+func snapshotFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yml", ".yaml":
+		return "yaml"
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package helpers_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot files", func() {
+	var (
+		dir  string
+		data helpers.PGOutputData
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		data = helpers.PGOutputData{
+			Roles: map[string]helpers.PGRole{
+				"pgadmin": {Name: "pgadmin", Super: true, Inherit: true, CanLogin: true, ConnLimit: -1, ValidUntil: "2017-05-05T11:00:00+00:00"},
+			},
+			Databases: []helpers.PGDatabase{
+				{
+					Name:   "db1",
+					DBExts: []helpers.PGDatabaseExtensions{{Name: "plpgsql"}},
+					Tables: []helpers.PGTable{
+						{
+							SchemaName:     "public",
+							TableName:      "t1",
+							TableOwner:     "pgadmin",
+							TableColumns:   []helpers.PGTableColumn{{ColumnName: "id", DataType: "integer", Position: 1}},
+							TableRowsCount: helpers.PGCount{Num: 5},
+							Checksum:       "0cc175b9c0f1b6a831c399e269772661",
+						},
+					},
+				},
+			},
+			Settings: map[string]string{"port": "5432", "log_line_prefix": "%m: "},
+			SettingDetails: map[string]helpers.PGSetting{
+				"port": {Name: "port", Setting: "5432", VarType: "integer"},
+			},
+			Version: helpers.PGVersion{Version: "PostgreSQL 16.6 on x86_64-pc-linux-gnu"},
+		}
+	})
+
+	for _, name := range []string{"snapshot.json", "snapshot.yml", "snapshot.YAML"} {
+		It("Saves and reloads "+name, func() {
+			path := filepath.Join(dir, name)
+			err := helpers.NewPGSnapshot(data, "44").Save(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			snapshot, err := helpers.LoadPGSnapshot(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(snapshot.FormatVersion).To(Equal(helpers.PGSnapshotFormatVersion))
+			Expect(snapshot.ReleaseVersion).To(Equal("44"))
+			Expect(snapshot.ServerVersion).To(Equal("PostgreSQL 16.6 on x86_64-pc-linux-gnu"))
+			Expect(snapshot.Data).To(Equal(data))
+			Expect(helpers.DiffPGOutputData(snapshot.Data, data).IsEmpty()).To(BeTrue())
+		})
+	}
+
+	It("Fails to save or load a file with an unknown extension", func() {
+		path := filepath.Join(dir, "snapshot.txt")
+		Expect(helpers.NewPGSnapshot(data, "44").Save(path)).To(MatchError(ContainSubstring("Unknown snapshot format")))
+		_, err := helpers.LoadPGSnapshot(path)
+		Expect(err).To(MatchError(ContainSubstring("Unknown snapshot format")))
+	})
+
+	It("Fails to load a snapshot with an unsupported format version", func() {
+		path := filepath.Join(dir, "snapshot.yml")
+		Expect(os.WriteFile(path, []byte("format_version: 99\n"), 0644)).To(Succeed())
+		_, err := helpers.LoadPGSnapshot(path)
+		Expect(err).To(MatchError(ContainSubstring("format version 99")))
+	})
+
+	It("Fails to load a missing file", func() {
+		_, err := helpers.LoadPGSnapshot(filepath.Join(dir, "missing.json"))
+		Expect(err).To(HaveOccurred())
+	})
+})
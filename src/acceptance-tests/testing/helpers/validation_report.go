@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+const (
+	CategoryVersion    = "version"
+	CategoryDatabases  = "databases"
+	CategoryExtensions = "extensions"
+	CategoryRoles      = "roles"
+	CategoryGrants     = "grants"
+	CategoryPasswords  = "passwords"
+	CategorySettings   = "settings"
+	CategoryCollations = "collations"
+	CategoryUpgrade    = "upgrade"
+)
+
+// ValidationFinding is one way the deployment differs from what the manifest
+// asks for. Message is the error the matching Validate method returns.
+type ValidationFinding struct {
+	Category string
+	Severity string
+	Object   string
+	Expected string
+	Actual   string
+	Message  string
+}
+
+func (f ValidationFinding) String() string {
+	result := fmt.Sprintf("[%s] %s %s: %s", f.Severity, f.Category, f.Object, f.Message)
+	if f.Expected != "" || f.Actual != "" {
+		result += fmt.Sprintf("\n    expected: %s\n    actual:   %s", f.Expected, f.Actual)
+	}
+	return result
+}
+
+// ValidationReport collects every finding of a validation run instead of
+// stopping at the first one. It is an error, listing all the findings, so
+// that a failed Expect shows them at once.
+type ValidationReport struct {
+	Findings []ValidationFinding
+}
+
+func (r *ValidationReport) Add(category, severity, object string, expected, actual interface{}, message string) {
+	r.Findings = append(r.Findings, ValidationFinding{
+		Category: category,
+		Severity: severity,
+		Object:   object,
+		Expected: fmt.Sprintf("%v", expected),
+		Actual:   fmt.Sprintf("%v", actual),
+		Message:  message,
+	})
+}
+
+func (r ValidationReport) bySeverity(severity string) []ValidationFinding {
+	var result []ValidationFinding
+	for _, f := range r.Findings {
+		if f.Severity == severity {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func (r ValidationReport) Failures() []ValidationFinding {
+	return r.bySeverity(SeverityError)
+}
+func (r ValidationReport) Warnings() []ValidationFinding {
+	return r.bySeverity(SeverityWarning)
+}
+
+// Err returns the report when it has any failure and nil otherwise, so that
+// warnings alone do not fail a spec.
+func (r ValidationReport) Err() error {
+	if len(r.Failures()) == 0 {
+		return nil
+	}
+	return r
+}
+
+// FirstError returns the message of the first failure as an error, the way
+// the Validate methods report it, or nil.
+func (r ValidationReport) FirstError() error {
+	failures := r.Failures()
+	if len(failures) == 0 {
+		return nil
+	}
+	return errors.New(failures[0].Message)
+}
+
+func (r ValidationReport) Error() string {
+	lines := []string{fmt.Sprintf("%d validation failures, %d warnings:", len(r.Failures()), len(r.Warnings()))}
+	for _, f := range r.Findings {
+		lines = append(lines, "  "+strings.ReplaceAll(f.String(), "\n", "\n  "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// GomegaString keeps gomega from dumping the findings a second time after
+// the error message.
+func (r ValidationReport) GomegaString() string {
+	return fmt.Sprintf("%d findings", len(r.Findings))
+}
@@ -0,0 +1,49 @@
+package helpers_test
+
+import (
+	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validation report", func() {
+	var report helpers.ValidationReport
+
+	BeforeEach(func() {
+		report = helpers.ValidationReport{}
+		report.Add(helpers.CategoryRoles, helpers.SeverityError, "pgadmin", "present", "missing", "Role pgadmin has not been created")
+		report.Add(helpers.CategoryExtensions, helpers.SeverityWarning, "db1: citext", "1.8", "1.6", "Extension citext for database db1 is outdated")
+		report.Add(helpers.CategorySettings, helpers.SeverityError, "port", 5524, "5432", "Incorrect value 5524 instead of 5432 for setting port")
+	})
+
+	It("Splits the findings by severity", func() {
+		Expect(report.Failures()).To(HaveLen(2))
+		Expect(report.Warnings()).To(Equal([]helpers.ValidationFinding{
+			{Category: "extensions", Severity: "warning", Object: "db1: citext", Expected: "1.8", Actual: "1.6", Message: "Extension citext for database db1 is outdated"},
+		}))
+	})
+
+	It("Returns the first failure the way the Validate methods do", func() {
+		Expect(report.FirstError()).To(MatchError("Role pgadmin has not been created"))
+	})
+
+	It("Lists every finding in its error", func() {
+		Expect(report.Err()).To(MatchError(`2 validation failures, 1 warnings:
+  [error] roles pgadmin: Role pgadmin has not been created
+      expected: present
+      actual:   missing
+  [warning] extensions db1: citext: Extension citext for database db1 is outdated
+      expected: 1.8
+      actual:   1.6
+  [error] settings port: Incorrect value 5524 instead of 5432 for setting port
+      expected: 5524
+      actual:   5432`))
+	})
+
+	It("Is not an error with warnings only", func() {
+		warnings := helpers.ValidationReport{Findings: report.Warnings()}
+		Expect(warnings.Err()).To(Succeed())
+		Expect(warnings.FirstError()).To(Succeed())
+	})
+})
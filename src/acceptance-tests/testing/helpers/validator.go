@@ -1,10 +1,9 @@
 package helpers
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"sort"
-	"strconv"
 	"strings"
 )
 
@@ -20,11 +19,23 @@ const MissingDatabaseValidationError = "Database %s has not been created"
 const ExtraDatabaseValidationError = "Extra database %s has been created"
 const MissingExtensionValidationError = "Extension %s for database %s has not been created"
 const ExtraExtensionValidationError = "Extra extension %s for database %s has been created"
+const OutdatedExtensionValidationError = "Extension %s for database %s is at version %s instead of %s: run ALTER EXTENSION %s UPDATE"
 const MissingRoleValidationError = "Role %s has not been created"
 const ExtraRoleValidationError = "Extra role %s has been created"
 const IncorrectRolePrmissionValidationError = "Incorrect permissions for role %s"
+const InvalidRolePermissionsValidationError = "Invalid permissions for role %s: %v"
+const InvalidRoleValidUntilValidationError = "Cannot convert VALID UNTIL %s of role %s: %v"
+const MissingGrantValidationError = "Role %s has not been granted %s on %s"
+const ExtraGrantValidationError = "Unexpected %s granted to role %s on %s"
+const ExtraMembershipValidationError = "Unexpected membership of role %s in role %s"
+const IncorrectPasswordStorageValidationError = "Password of role %s is stored as %s instead of %s"
 const IncorrectSettingValidationError = "Incorrect value %v instead of %v for setting %s"
 const MissingSettingValidationError = "Missing setting %s"
+const InvalidSettingValidationError = "Invalid value %v for setting %s: %v"
+const PendingRestartValidationError = "Settings %s are waiting for a restart to take effect"
+const CollationVersionValidationError = "Collation %s of database %s was created with version %s but the system provides %s, indexes to REINDEX: %s"
+const UnusedCollationVersionValidationError = "Collation %s of database %s was created with version %s but the system provides %s, no index uses it"
+const ChangedPropertyValidationError = "%s of %s changed from %s to %s"
 
 type PGDBSorter []PGDatabase
 
@@ -64,213 +75,613 @@ func NewValidator(props Properties, pgData PGOutputData, pg PGData, postgresqlVe
 }
 
 func (v Validator) ValidatePostgreSQLVersion() error {
-	if !strings.HasPrefix(v.PostgresData.Version.Version, v.PostgreSQLVersion) {
-		return errors.New(fmt.Sprintf(WrongPostreSQLVersionError, v.PostgresData.Version.Version, v.PostgreSQLVersion))
+	var r ValidationReport
+	v.checkPostgreSQLVersion(&r)
+	return r.FirstError()
+}
+
+// checkPostgreSQLVersion compares the numbers of the versions, so that the
+// expected version 16.1 does not match a server running 16.10.
+func (v Validator) checkPostgreSQLVersion(r *ValidationReport) {
+	actual := v.PostgresData.Version.Version
+	actualNumber, actualErr := ParsePGVersion(actual)
+	expectedNumber, expectedErr := ParsePGVersion(v.PostgreSQLVersion)
+	if actualErr != nil || expectedErr != nil || !actualNumber.Matches(expectedNumber) {
+		r.Add(CategoryVersion, SeverityError, "server", v.PostgreSQLVersion, actual, fmt.Sprintf(WrongPostreSQLVersionError, actual, v.PostgreSQLVersion))
 	}
-	return nil
 }
 
 func (v Validator) ValidateDatabases() error {
-	actual := v.PostgresData.Databases
-	expected := v.ManifestProps.Databases.Databases
-	sort.Sort(PGDBSorter(actual))
-	sort.Sort(PgDBPropsSorter(expected))
-	for idx, actualDB := range actual {
-		if actualDB.Name == DefaultDB && idx > len(expected)-1 {
-			break
-		}
-		if idx > len(expected)-1 || actualDB.Name < expected[idx].Name {
-			if actualDB.Name != DefaultDB {
-				return errors.New(fmt.Sprintf(ExtraDatabaseValidationError, actualDB.Name))
-			}
+	var r ValidationReport
+	v.checkDatabases(&r)
+	return r.FirstError()
+}
+
+// checkDatabases reports the manifest databases that are missing, the
+// databases that should not be there and, for each manifest database, the
+// extensions the release should or should not have created.
+func (v Validator) checkDatabases(r *ValidationReport) {
+	actual := make(map[string]PGDatabase)
+	for _, db := range v.PostgresData.Databases {
+		actual[db.Name] = db
+	}
+	expected := make(map[string]PgDBProperties)
+	for _, db := range v.ManifestProps.Databases.Databases {
+		expected[db.Name] = db
+	}
+	names := sortedKeys(actual)
+	for _, name := range sortedKeys(expected) {
+		if _, ok := actual[name]; !ok {
+			names = append(names, name)
 		}
-		if actualDB.Name == DefaultDB || actualDB.Name > expected[idx].Name {
-			return errors.New(fmt.Sprintf(MissingDatabaseValidationError, expected[idx].Name))
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		actualDB, isActual := actual[name]
+		expectedDB, isExpected := expected[name]
+		switch {
+		case !isExpected && name != DefaultDB:
+			r.Add(CategoryDatabases, SeverityError, name, "absent", "present", fmt.Sprintf(ExtraDatabaseValidationError, name))
+		case !isActual:
+			r.Add(CategoryDatabases, SeverityError, name, "present", "missing", fmt.Sprintf(MissingDatabaseValidationError, name))
+		case isExpected:
+			v.checkDatabaseExtensions(r, actualDB, expectedDB)
 		}
-		extMap := map[string]bool{
-			"plpgsql":            false,
-			"pgcrypto":           false,
-			"citext":             false,
-			"pg_stat_statements": false,
+	}
+}
+
+func (v Validator) checkDatabaseExtensions(r *ValidationReport, actual PGDatabase, expected PgDBProperties) {
+	missing := func(ext string) {
+		r.Add(CategoryExtensions, SeverityError, expected.Name+": "+ext, "present", "missing", fmt.Sprintf(MissingExtensionValidationError, ext, expected.Name))
+	}
+	extra := func(ext string) {
+		r.Add(CategoryExtensions, SeverityError, expected.Name+": "+ext, "absent", "present", fmt.Sprintf(ExtraExtensionValidationError, ext, expected.Name))
+	}
+	extMap := map[string]bool{
+		"plpgsql":            false,
+		"pgcrypto":           false,
+		"citext":             false,
+		"pg_stat_statements": false,
+	}
+	for _, dbExt := range actual.DBExts {
+		if _, ok := extMap[dbExt.Name]; !ok {
+			extra(dbExt.Name)
+			continue
 		}
-		for _, dbExt := range actualDB.DBExts {
-			if _, ok := extMap[dbExt.Name]; !ok {
-				return errors.New(fmt.Sprintf(ExtraExtensionValidationError, dbExt.Name, expected[idx].Name))
+		extMap[dbExt.Name] = true
+	}
+	if !extMap["pgcrypto"] {
+		missing("pgcrypto")
+	}
+	if expected.CITExt && !extMap["citext"] {
+		missing("citext")
+	} else if !expected.CITExt && extMap["citext"] {
+		extra("citext")
+	}
+	if v.ManifestProps.Databases.CollectStatementStats && !extMap["pg_stat_statements"] {
+		missing("pg_stat_statements")
+	} else if !v.ManifestProps.Databases.CollectStatementStats && extMap["pg_stat_statements"] {
+		extra("pg_stat_statements")
+	}
+}
+
+// NeedsUpdate reports whether a newer version of the extension is available
+// than the installed one.
+func (e PGDatabaseExtensions) NeedsUpdate() bool {
+	return e.DefaultVersion != "" && e.Version != e.DefaultVersion
+}
+
+// OutdatedExtensions returns the extensions that are not at their default
+// version, as pg_upgrade leaves them, as "database: extension".
+func (v Validator) OutdatedExtensions() []string {
+	var result []string
+	for _, db := range v.PostgresData.Databases {
+		for _, ext := range db.DBExts {
+			if ext.NeedsUpdate() {
+				result = append(result, fmt.Sprintf("%s: %s", db.Name, ext.Name))
 			}
-			extMap[dbExt.Name] = true
 		}
-		if !extMap["pgcrypto"] {
-			return errors.New(fmt.Sprintf(MissingExtensionValidationError, "pgcrypto", expected[idx].Name))
-		}
-		if expected[idx].CITExt && !extMap["citext"] {
-			return errors.New(fmt.Sprintf(MissingExtensionValidationError, "citext", expected[idx].Name))
-		} else if !expected[idx].CITExt && extMap["citext"] {
-			return errors.New(fmt.Sprintf(ExtraExtensionValidationError, "citext", expected[idx].Name))
-		}
-		if v.ManifestProps.Databases.CollectStatementStats && !extMap["pg_stat_statements"] {
-			return errors.New(fmt.Sprintf(MissingExtensionValidationError, "pg_stat_statements", expected[idx].Name))
-		} else if !v.ManifestProps.Databases.CollectStatementStats && extMap["pg_stat_statements"] {
-			return errors.New(fmt.Sprintf(ExtraExtensionValidationError, "pg_stat_statements", expected[idx].Name))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ValidateExtensionVersions fails on the first extension that needs
+// ALTER EXTENSION ... UPDATE.
+func (v Validator) ValidateExtensionVersions() error {
+	var r ValidationReport
+	v.checkExtensionVersions(&r, SeverityError)
+	return r.FirstError()
+}
+func (v Validator) checkExtensionVersions(r *ValidationReport, severity string) {
+	for _, db := range v.PostgresData.Databases {
+		for _, ext := range db.DBExts {
+			if ext.NeedsUpdate() {
+				r.Add(CategoryExtensions, severity, db.Name+": "+ext.Name, ext.DefaultVersion, ext.Version, fmt.Sprintf(OutdatedExtensionValidationError, ext.Name, db.Name, ext.Version, ext.DefaultVersion, ext.Name))
+			}
 		}
 	}
-	return nil
 }
+
 func (v Validator) ValidateRoles() error {
-	var err error
+	var r ValidationReport
+	v.checkRoles(&r)
+	return r.FirstError()
+}
+func (v Validator) checkRoles(r *ValidationReport) {
 	actual := v.PostgresData.Roles
 	expected := v.ManifestProps.Databases.Roles
 
 	for _, expectedRole := range expected {
 		actualRole, ok := actual[expectedRole.Name]
 		if !ok {
-			return errors.New(fmt.Sprintf(MissingRoleValidationError, expectedRole.Name))
+			r.Add(CategoryRoles, SeverityError, expectedRole.Name, "present", "missing", fmt.Sprintf(MissingRoleValidationError, expectedRole.Name))
+			continue
 		}
 
-		defaultRole := PGRole{
-			Name:        actualRole.Name,
-			Super:       false,
-			Inherit:     true,
-			CreateRole:  false,
-			CreateDb:    false,
-			CanLogin:    true,
-			Replication: false,
-			ConnLimit:   -1,
-			ValidUntil:  "",
+		options, err := ParseRoleOptions(expectedRole.Permissions)
+		if err != nil {
+			r.Add(CategoryRoles, SeverityError, expectedRole.Name, "valid permissions", strings.Join(expectedRole.Permissions, " "), fmt.Sprintf(InvalidRolePermissionsValidationError, expectedRole.Name, err))
+			continue
 		}
-		for _, elem := range expectedRole.Permissions {
-			switch {
-			case elem == "SUPERUSER":
-				defaultRole.Super = true
-			case elem == "CREATEDB":
-				defaultRole.CreateDb = true
-			case elem == "CREATEROLE":
-				defaultRole.CreateRole = true
-			case elem == "NOINHERIT":
-				defaultRole.Inherit = false
-			case elem == "NOLOGIN":
-				defaultRole.CanLogin = false
-			case elem == "REPLICATION":
-				defaultRole.Replication = true
-			case strings.Contains(elem, "CONNECTION LIMIT"):
-				value, err := strconv.Atoi(strings.SplitAfter(elem, "CONNECTION LIMIT ")[1])
-				if err != nil {
-					return err
-				}
-				defaultRole.ConnLimit = value
-			case strings.Contains(elem, "VALID UNTIL"):
-				defaultRole.ValidUntil, err = v.PG.ConvertToPostgresDate(strings.SplitAfter(elem, "VALID UNTIL ")[1])
-				if err != nil {
-					return err
-				}
-			default:
+		defaultRole := options.Role
+		defaultRole.Name = actualRole.Name
+		if options.ValidUntil != "" {
+			defaultRole.ValidUntil, err = v.PG.ConvertToPostgresDate(options.ValidUntil)
+			if err != nil {
+				r.Add(CategoryRoles, SeverityError, expectedRole.Name, "valid permissions", strings.Join(expectedRole.Permissions, " "), fmt.Sprintf(InvalidRoleValidUntilValidationError, options.ValidUntil, expectedRole.Name, err))
+				continue
 			}
 		}
 		if defaultRole != actualRole {
-			return errors.New(fmt.Sprintf(IncorrectRolePrmissionValidationError, actualRole.Name))
+			r.Add(CategoryRoles, SeverityError, actualRole.Name, roleAttributes(defaultRole), roleAttributes(actualRole), fmt.Sprintf(IncorrectRolePrmissionValidationError, actualRole.Name))
 		}
 	}
+}
+
+// roleAttributes renders the attributes of role the way CREATE ROLE takes
+// them.
+func roleAttributes(role PGRole) string {
+	flag := func(on bool, name string) string {
+		if on {
+			return name
+		}
+		return "NO" + name
+	}
+	attributes := []string{
+		flag(role.Super, "SUPERUSER"),
+		flag(role.CreateDb, "CREATEDB"),
+		flag(role.CreateRole, "CREATEROLE"),
+		flag(role.Inherit, "INHERIT"),
+		flag(role.CanLogin, "LOGIN"),
+		flag(role.Replication, "REPLICATION"),
+		flag(role.BypassRLS, "BYPASSRLS"),
+		fmt.Sprintf("CONNECTION LIMIT %d", role.ConnLimit),
+	}
+	if role.ValidUntil != "" {
+		attributes = append(attributes, fmt.Sprintf("VALID UNTIL '%s'", role.ValidUntil))
+	}
+	return strings.Join(attributes, " ")
+}
+
+// ValidateGrants reads the grants of the manifest databases and checks them
+// with MatchGrants.
+func (v Validator) ValidateGrants() error {
+	return v.ValidateGrantsContext(context.Background())
+}
+func (v Validator) ValidateGrantsContext(ctx context.Context) error {
+	var r ValidationReport
+	if err := v.checkGrantsContext(ctx, &r); err != nil {
+		return err
+	}
+	return r.FirstError()
+}
+func (v Validator) checkGrantsContext(ctx context.Context, r *ValidationReport) error {
+	var dbNames []string
+	for _, db := range v.ManifestProps.Databases.Databases {
+		dbNames = append(dbNames, db.Name)
+	}
+	grants, err := v.PG.GetGrantsContext(ctx, dbNames...)
+	if err != nil {
+		return err
+	}
+	v.checkGrants(r, grants)
 	return nil
 }
 
-// TODO cover all setting types
-// PostgreSQL stores setting as formatted strings
-// the value in the postgresql.conf may not match the value from pg_settings view
-// e.g. the shared_buffer property is stored as an int but can be specified as 128MB
+// MatchGrants checks that every manifest role can connect to every manifest
+// database and has been granted ALL on its public schema, which PostgreSQL 15
+// and later no longer grant to PUBLIC. Privileges granted to a manifest role
+// on anything else, except on objects it owns, and any role membership are
+// reported as unexpected: the release applies the permissions with ALTER
+// ROLE, which cannot grant memberships.
+func (v Validator) MatchGrants(grants PGGrants) error {
+	var r ValidationReport
+	v.checkGrants(&r, grants)
+	return r.FirstError()
+}
+func (v Validator) checkGrants(r *ValidationReport, grants PGGrants) {
+	props := v.ManifestProps.Databases
+	manifestRoles := make(map[string]bool)
+	for _, role := range props.Roles {
+		manifestRoles[role.Name] = true
+	}
+	manifestDBs := make(map[string]bool)
+	for _, db := range props.Databases {
+		manifestDBs[db.Name] = true
+	}
+	extra := func(privilege, grantee, object string) {
+		r.Add(CategoryGrants, SeverityError, object, "not granted", privilege+" to "+grantee, fmt.Sprintf(ExtraGrantValidationError, privilege, grantee, object))
+	}
+
+	granted := make(map[string]bool)
+	for _, p := range grants.Databases {
+		granted[grantKey("database "+p.Database, p.Grantee, p.Privilege)] = true
+		if manifestRoles[p.Grantee] && p.Grantee != p.Owner {
+			extra(p.Privilege, p.Grantee, "database "+p.Database)
+		}
+	}
+	for _, p := range grants.Schemas {
+		object := fmt.Sprintf("schema %s: %s", p.Database, p.Schema)
+		granted[grantKey(object, p.Grantee, p.Privilege)] = true
+		expected := manifestDBs[p.Database] && p.Schema == "public" && (p.Privilege == "USAGE" || p.Privilege == "CREATE")
+		if manifestRoles[p.Grantee] && p.Grantee != p.Owner && !expected {
+			extra(p.Privilege, p.Grantee, object)
+		}
+	}
+	for _, p := range grants.Tables {
+		if manifestRoles[p.Grantee] && p.Grantee != p.Owner {
+			extra(p.Privilege, p.Grantee, fmt.Sprintf("table %s: %s.%s", p.Database, p.Schema, p.Table))
+		}
+	}
+	for _, m := range grants.Memberships {
+		if manifestRoles[m.Member] {
+			r.Add(CategoryGrants, SeverityError, "role "+m.Member, "not a member of "+m.Role, "member of "+m.Role, fmt.Sprintf(ExtraMembershipValidationError, m.Member, m.Role))
+		}
+	}
+
+	expectedDBs := append([]PgDBProperties{}, props.Databases...)
+	sort.Sort(PgDBPropsSorter(expectedDBs))
+	for _, db := range expectedDBs {
+		for _, role := range props.Roles {
+			object := "database " + db.Name
+			if !granted[grantKey(object, role.Name, "CONNECT")] && !granted[grantKey(object, PublicGrantee, "CONNECT")] {
+				r.Add(CategoryGrants, SeverityError, object, "CONNECT to "+role.Name, "not granted", fmt.Sprintf(MissingGrantValidationError, role.Name, "CONNECT", object))
+			}
+			object = fmt.Sprintf("schema %s: public", db.Name)
+			for _, privilege := range []string{"USAGE", "CREATE"} {
+				if !granted[grantKey(object, role.Name, privilege)] {
+					r.Add(CategoryGrants, SeverityError, object, privilege+" to "+role.Name, "not granted", fmt.Sprintf(MissingGrantValidationError, role.Name, privilege, object))
+				}
+			}
+		}
+	}
+}
+
+func grantKey(object, grantee, privilege string) string {
+	return object + " " + grantee + " " + privilege
+}
+
+// ValidatePasswordStorage reads how the role passwords are stored and checks
+// them with MatchPasswordStorage.
+func (v Validator) ValidatePasswordStorage() error {
+	return v.ValidatePasswordStorageContext(context.Background())
+}
+func (v Validator) ValidatePasswordStorageContext(ctx context.Context) error {
+	var r ValidationReport
+	if err := v.checkPasswordStorageContext(ctx, &r); err != nil {
+		return err
+	}
+	return r.FirstError()
+}
+func (v Validator) checkPasswordStorageContext(ctx context.Context, r *ValidationReport) error {
+	methods, err := v.PG.ListPasswordMethodsContext(ctx)
+	if err != nil {
+		return err
+	}
+	v.checkPasswordStorage(r, methods)
+	return nil
+}
+
+// MatchPasswordStorage checks that the password of every manifest role is
+// stored with the method password_encryption selects, and that roles without
+// a password, or with PASSWORD NULL, have none.
+func (v Validator) MatchPasswordStorage(methods map[string]string) error {
+	var r ValidationReport
+	v.checkPasswordStorage(&r, methods)
+	return r.FirstError()
+}
+func (v Validator) checkPasswordStorage(r *ValidationReport, methods map[string]string) {
+	encryption, ok := v.PostgresData.Settings["password_encryption"]
+	if !ok {
+		r.Add(CategorySettings, SeverityError, "password_encryption", "set", "missing", fmt.Sprintf(MissingSettingValidationError, "password_encryption"))
+		return
+	}
+	for _, role := range v.ManifestProps.Databases.Roles {
+		options, err := ParseRoleOptions(role.Permissions)
+		if err != nil {
+			r.Add(CategoryRoles, SeverityError, role.Name, "valid permissions", strings.Join(role.Permissions, " "), fmt.Sprintf(InvalidRolePermissionsValidationError, role.Name, err))
+			continue
+		}
+		password := role.Password
+		if options.Password != nil {
+			password = *options.Password
+		}
+		expected := passwordMethod(password, encryption)
+		if actual := methods[role.Name]; actual != expected {
+			r.Add(CategoryPasswords, SeverityError, role.Name, passwordMethodName(expected), passwordMethodName(actual), fmt.Sprintf(IncorrectPasswordStorageValidationError, role.Name, passwordMethodName(actual), passwordMethodName(expected)))
+		}
+	}
+}
+
+// passwordMethod returns how PostgreSQL stores password given the
+// password_encryption setting. Passwords already hashed are stored as is.
+func passwordMethod(password string, encryption string) string {
+	switch {
+	case password == "":
+		return PasswordMethodNone
+	case strings.HasPrefix(password, "SCRAM-SHA-256$"):
+		return PasswordMethodSCRAM
+	case len(password) == 35 && strings.HasPrefix(password, PasswordMethodMD5):
+		return PasswordMethodMD5
+	}
+	switch encryption {
+	case "on", PasswordMethodMD5:
+		// Before PostgreSQL 10 password_encryption was a boolean.
+		return PasswordMethodMD5
+	case "off":
+		return PasswordMethodPlain
+	}
+	return encryption
+}
+
+func passwordMethodName(method string) string {
+	if method == PasswordMethodNone {
+		return "no password"
+	}
+	return method
+}
+
+// MatchSetting checks that value, as written in postgresql.conf, matches the
+// setting in pg_settings. With the pg_settings row at hand, sizes, durations,
+// booleans, enums and real numbers are compared by meaning, so that 128MB
+// matches the 16384 pages shared_buffers reports; otherwise the values must
+// be identical strings.
 func (v Validator) MatchSetting(key string, value interface{}) error {
+	var r ValidationReport
+	v.checkSetting(&r, key, value)
+	return r.FirstError()
+}
+func (v Validator) checkSetting(r *ValidationReport, key string, value interface{}) {
 	settings := v.PostgresData.Settings
 	stringValue := fmt.Sprintf("%v", value)
 	expected, ok := settings[key]
 	if !ok {
-		return errors.New(fmt.Sprintf(MissingSettingValidationError, key))
-	} else if expected != stringValue {
-		return errors.New(fmt.Sprintf(IncorrectSettingValidationError, stringValue, expected, key))
+		r.Add(CategorySettings, SeverityError, key, stringValue, "missing", fmt.Sprintf(MissingSettingValidationError, key))
+		return
+	}
+	match := expected == stringValue
+	if detail, ok := v.PostgresData.SettingDetails[key]; ok {
+		var err error
+		match, err = detail.Matches(value)
+		if err != nil {
+			r.Add(CategorySettings, SeverityError, key, stringValue, expected, fmt.Sprintf(InvalidSettingValidationError, stringValue, key, err))
+			return
+		}
+	}
+	if !match {
+		r.Add(CategorySettings, SeverityError, key, stringValue, expected, fmt.Sprintf(IncorrectSettingValidationError, stringValue, expected, key))
 	}
-	return nil
 }
+
 func (v Validator) ValidateSettings() error {
-	var err error
+	var r ValidationReport
+	v.checkSettings(&r)
+	return r.FirstError()
+}
+func (v Validator) checkSettings(r *ValidationReport) {
 	props := v.ManifestProps.Databases
-	for key, value := range props.AdditionalConfig {
-		err = v.MatchSetting(key, value)
-		if err != nil {
-			return err
+	for _, key := range sortedKeys(props.AdditionalConfig) {
+		v.checkSetting(r, key, props.AdditionalConfig[key])
+	}
+	v.checkSetting(r, "port", props.Port)
+	v.checkSetting(r, "max_connections", props.MaxConnections)
+	v.checkSetting(r, "log_line_prefix", props.LogLinePrefix)
+}
+
+// ValidateSettingsContract checks every setting postgresql.conf.erb writes
+// for the manifest properties, not only the ones ValidateSettings covers.
+func (v Validator) ValidateSettingsContract() error {
+	var r ValidationReport
+	v.checkSettingsContract(&r)
+	return r.FirstError()
+}
+func (v Validator) checkSettingsContract(r *ValidationReport) {
+	expected := ExpectedSettings(v.ManifestProps)
+	for _, key := range sortedKeys(expected) {
+		v.checkSetting(r, key, expected[key])
+	}
+}
+
+// PendingRestartSettings lists the settings changed in the configuration
+// files whose new value only applies once the server is restarted.
+func (v Validator) PendingRestartSettings() []string {
+	var result []string
+	for name, setting := range v.PostgresData.SettingDetails {
+		if setting.PendingRestart {
+			result = append(result, name)
 		}
 	}
-	err = v.MatchSetting("port", props.Port)
-	if err != nil {
-		return err
+	sort.Strings(result)
+	return result
+}
+func (v Validator) ValidateNoPendingRestart() error {
+	var r ValidationReport
+	v.checkNoPendingRestart(&r)
+	return r.FirstError()
+}
+func (v Validator) checkNoPendingRestart(r *ValidationReport) {
+	pending := v.PendingRestartSettings()
+	if len(pending) > 0 {
+		object := strings.Join(pending, ", ")
+		r.Add(CategorySettings, SeverityError, object, "applied", "pending restart", fmt.Sprintf(PendingRestartValidationError, object))
 	}
-	err = v.MatchSetting("max_connections", props.MaxConnections)
-	if err != nil {
+}
+
+// ValidateCollationVersions reads the collation versions of every database
+// and checks them with MatchCollationVersions.
+func (v Validator) ValidateCollationVersions() error {
+	return v.ValidateCollationVersionsContext(context.Background())
+}
+func (v Validator) ValidateCollationVersionsContext(ctx context.Context) error {
+	var r ValidationReport
+	if err := v.checkCollationVersionsContext(ctx, &r); err != nil {
 		return err
 	}
-	err = v.MatchSetting("log_line_prefix", props.LogLinePrefix)
+	return r.FirstError()
+}
+func (v Validator) checkCollationVersionsContext(ctx context.Context, r *ValidationReport) error {
+	drifts, err := v.PG.GetCollationDriftContext(ctx)
 	if err != nil {
 		return err
 	}
+	v.checkCollationVersions(r, drifts)
 	return nil
 }
-func (v Validator) ValidateAll() error {
-	var err error
-	err = v.ValidateDatabases()
-	if err != nil {
-		return err
-	}
-	err = v.ValidateRoles()
-	if err != nil {
-		return err
+
+// MatchCollationVersions fails on collations whose version changed under
+// the databases, listing the indexes to rebuild. Drifted collations that are
+// neither a database default nor used by an index are only warned about.
+func (v Validator) MatchCollationVersions(drifts []PGCollationDrift) error {
+	var r ValidationReport
+	v.checkCollationVersions(&r, drifts)
+	return r.FirstError()
+}
+func (v Validator) checkCollationVersions(r *ValidationReport, drifts []PGCollationDrift) {
+	for _, d := range drifts {
+		object := d.Database + ": " + d.Collation
+		if !d.InUse() {
+			r.Add(CategoryCollations, SeverityWarning, object, d.Version, d.ActualVersion, fmt.Sprintf(UnusedCollationVersionValidationError, d.Collation, d.Database, d.Version, d.ActualVersion))
+			continue
+		}
+		indexes := "none"
+		if len(d.Indexes) > 0 {
+			indexes = strings.Join(d.Indexes, ", ")
+		}
+		r.Add(CategoryCollations, SeverityError, object, d.Version, d.ActualVersion, fmt.Sprintf(CollationVersionValidationError, d.Collation, d.Database, d.Version, d.ActualVersion, indexes))
 	}
-	err = v.ValidateSettings()
-	if err != nil {
-		return err
+}
+
+// Report runs the checks of ValidateAll and returns all their findings.
+// Extensions left at an older version are reported as warnings.
+func (v Validator) Report() (ValidationReport, error) {
+	return v.report(func(r *ValidationReport) error {
+		v.checkSettings(r)
+		return nil
+	})
+}
+
+// FullReport adds to Report the grants, the password storage, the collation
+// versions and every setting of the job template.
+func (v Validator) FullReport() (ValidationReport, error) {
+	return v.FullReportContext(context.Background())
+}
+func (v Validator) FullReportContext(ctx context.Context) (ValidationReport, error) {
+	return v.report(
+		func(r *ValidationReport) error { return v.checkGrantsContext(ctx, r) },
+		func(r *ValidationReport) error { return v.checkPasswordStorageContext(ctx, r) },
+		func(r *ValidationReport) error { return v.checkCollationVersionsContext(ctx, r) },
+		func(r *ValidationReport) error {
+			v.checkSettingsContract(r)
+			return nil
+		},
+	)
+}
+
+// report runs the checks Report and FullReport have in common, with checks
+// run after the roles and before the pending restarts and the version.
+func (v Validator) report(checks ...func(*ValidationReport) error) (ValidationReport, error) {
+	var r ValidationReport
+	v.checkDatabases(&r)
+	v.checkExtensionVersions(&r, SeverityWarning)
+	v.checkRoles(&r)
+	for _, check := range checks {
+		if err := check(&r); err != nil {
+			return ValidationReport{}, err
+		}
 	}
-	err = v.ValidatePostgreSQLVersion()
+	v.checkNoPendingRestart(&r)
+	v.checkPostgreSQLVersion(&r)
+	return r, nil
+}
+
+// ValidateAll checks the databases, roles, settings and version, and returns
+// every failure at once as a ValidationReport.
+func (v Validator) ValidateAll() error {
+	r, err := v.Report()
 	if err != nil {
 		return err
 	}
-	return err
+	return r.Err()
 }
+
+// CompareTablesTo reports whether the databases and tables in data match
+// the validator snapshot. Use DiffTo to find out what differs.
 func (v Validator) CompareTablesTo(data PGOutputData) bool {
+	return !v.DiffTo(data).TablesChanged()
+}
 
-	aDBs := v.PostgresData.Databases
-	eDBs := data.Databases
-
-	result := (len(aDBs) == len(eDBs))
-	if result {
-		sort.Sort(PGDBSorter(aDBs))
-		sort.Sort(PGDBSorter(eDBs))
-		for i, db := range aDBs {
-			if db.Name != eDBs[i].Name ||
-				(len(db.Tables) != len(eDBs[i].Tables)) {
-				result = false
-				break
-			} else if len(db.Tables) > 0 {
-				sort.Sort(PGTableSorter(db.Tables))
-				sort.Sort(PGTableSorter(eDBs[i].Tables))
-				for j, table := range db.Tables {
-					vs := eDBs[i].Tables[j]
-					if vs.SchemaName != table.SchemaName ||
-						vs.TableName != table.TableName ||
-						vs.TableOwner != table.TableOwner ||
-						vs.TableRowsCount.Num != table.TableRowsCount.Num ||
-						len(vs.TableColumns) != len(table.TableColumns) {
-						result = false
-						break
-					}
-					sort.Sort(PGColumnSorter(vs.TableColumns))
-					sort.Sort(PGColumnSorter(table.TableColumns))
-					for k, col := range table.TableColumns {
-						vsc := eDBs[i].Tables[j].TableColumns[k]
-						if vsc.ColumnName != col.ColumnName ||
-							vsc.DataType != col.DataType ||
-							vsc.Position != col.Position {
-							result = false
-							break
-						}
-					}
-				}
-			}
-		}
+// CompareTableContentsTo returns the tables whose content checksum differs
+// from the one recorded in data, as "database: schema.table". Tables without
+// a checksum on either side are not compared.
+func (v Validator) CompareTableContentsTo(data PGOutputData) []string {
+	var result []string
+	for _, change := range v.DiffTo(data).ChangedChecksums {
+		result = append(result, change.Object)
 	}
 	return result
 }
+
+// PreservedSettings are the settings a major upgrade must carry over from the
+// old cluster: run_major_upgrade initializes the new one with the same data
+// checksums, and initdb with the same encoding.
+var PreservedSettings = []string{"data_checksums", "server_encoding"}
+
+// ValidatePreservedIn checks that data, taken after a major upgrade, keeps
+// the PreservedSettings and the encoding and locale of every database of the
+// validator snapshot, and returns every change at once as a
+// ValidationReport. Values the snapshot did not record are not compared.
+func (v Validator) ValidatePreservedIn(data PGOutputData) error {
+	var r ValidationReport
+	v.checkPreservedIn(&r, data)
+	return r.Err()
+}
+
+func (v Validator) checkPreservedIn(r *ValidationReport, data PGOutputData) {
+	for _, key := range PreservedSettings {
+		if before, ok := v.PostgresData.Settings[key]; ok {
+			checkPreserved(r, key, "the cluster", before, data.Settings[key])
+		}
+	}
+	beforeDBs := databasesByName(v.PostgresData.Databases)
+	afterDBs := databasesByName(data.Databases)
+	for _, name := range sortedKeys(beforeDBs) {
+		beforeDB := beforeDBs[name]
+		afterDB, ok := afterDBs[name]
+		if !ok {
+			continue
+		}
+		object := "database " + name
+		checkPreserved(r, "encoding", object, beforeDB.Encoding, afterDB.Encoding)
+		checkPreserved(r, "datcollate", object, beforeDB.Collate, afterDB.Collate)
+		checkPreserved(r, "datctype", object, beforeDB.CType, afterDB.CType)
+		checkPreserved(r, "locale provider", object, beforeDB.LocaleProvider, afterDB.LocaleProvider)
+	}
+}
+
+func checkPreserved(r *ValidationReport, property, object, before, after string) {
+	if before != "" && before != after {
+		r.Add(CategoryUpgrade, SeverityError, object, before, after, fmt.Sprintf(ChangedPropertyValidationError, property, object, before, after))
+	}
+}
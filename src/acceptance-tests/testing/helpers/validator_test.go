@@ -83,16 +83,28 @@ var _ = Describe("Validate deployment", func() {
 					Name: "db1",
 					DBExts: []helpers.PGDatabaseExtensions{
 						helpers.PGDatabaseExtensions{
-							Name: "pgcrypto",
+							Name:           "pgcrypto",
+							Version:        "1.3",
+							Schema:         "public",
+							DefaultVersion: "1.3",
 						},
 						helpers.PGDatabaseExtensions{
-							Name: "plpgsql",
+							Name:           "plpgsql",
+							Version:        "1.0",
+							Schema:         "pg_catalog",
+							DefaultVersion: "1.0",
 						},
 						helpers.PGDatabaseExtensions{
-							Name: "citext",
+							Name:           "citext",
+							Version:        "1.6",
+							Schema:         "public",
+							DefaultVersion: "1.6",
 						},
 						helpers.PGDatabaseExtensions{
-							Name: "pg_stat_statements",
+							Name:           "pg_stat_statements",
+							Version:        "1.10",
+							Schema:         "public",
+							DefaultVersion: "1.10",
 						},
 					},
 					Tables: []helpers.PGTable{},
@@ -114,14 +126,10 @@ var _ = Describe("Validate deployment", func() {
 		Expect(err).NotTo(HaveOccurred())
 		mocks[helpers.DefaultDB] = mock
 		pg := helpers.PGData{
-			Data: helpers.PGCommon{},
-			DBs: []helpers.PGConn{
-				helpers.PGConn{
-					DB:       db,
-					TargetDB: helpers.DefaultDB,
-				},
-			},
+			Data:  helpers.PGCommon{},
+			Conns: helpers.NewPGConnRegistry(),
 		}
+		pg.AddConnection(helpers.DefaultDB, pg.Data.DefUser, db)
 
 		validator = helpers.Validator{
 			ManifestProps:     manifestProps,
@@ -149,6 +157,10 @@ var _ = Describe("Validate deployment", func() {
 				err := validator.ValidateSettings()
 				Expect(err).NotTo(HaveOccurred())
 			})
+			It("Properly validates extension versions", func() {
+				Expect(validator.ValidateExtensionVersions()).To(Succeed())
+				Expect(validator.OutdatedExtensions()).To(BeEmpty())
+			})
 			It("Properly validates PostgreSQL version", func() {
 				err := validator.ValidatePostgreSQLVersion()
 				Expect(err).NotTo(HaveOccurred())
@@ -195,12 +207,39 @@ var _ = Describe("Validate deployment", func() {
 				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.ExtraExtensionValidationError, "citext", "db1"))))
 			})
 		})
+		Context("Validate extension versions", func() {
+			BeforeEach(func() {
+				validator.PostgresData.Databases[1].DBExts[2].DefaultVersion = "1.8"
+				validator.PostgresData.Databases[1].DBExts[3].DefaultVersion = "1.11"
+			})
+			It("Fails if an extension was not updated", func() {
+				err := validator.ValidateExtensionVersions()
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.OutdatedExtensionValidationError, "citext", "db1", "1.6", "1.8", "citext"))))
+			})
+			It("Lists every outdated extension", func() {
+				Expect(validator.OutdatedExtensions()).To(Equal([]string{"db1: citext", "db1: pg_stat_statements"}))
+			})
+			It("Ignores extensions with no available version", func() {
+				validator.PostgresData.Databases[1].DBExts[2].DefaultVersion = ""
+				validator.PostgresData.Databases[1].DBExts[3].DefaultVersion = ""
+				Expect(validator.ValidateExtensionVersions()).To(Succeed())
+			})
+		})
 		Context("Validate PostgreSQL version", func() {
 			It("Fails if wrong PostgreSQL version", func() {
 				validator.PostgreSQLVersion = "wrong value"
 				err := validator.ValidatePostgreSQLVersion()
 				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.WrongPostreSQLVersionError, "PostgreSQL 9.4.9", "wrong value"))))
 			})
+			It("Fails if the expected version is only a prefix of the actual one", func() {
+				validator.PostgresData.Version.Version = "PostgreSQL 16.10 on x86_64-pc-linux-gnu"
+				validator.PostgreSQLVersion = "PostgreSQL 16.1"
+				err := validator.ValidatePostgreSQLVersion()
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.WrongPostreSQLVersionError, "PostgreSQL 16.10 on x86_64-pc-linux-gnu", "PostgreSQL 16.1"))))
+
+				validator.PostgreSQLVersion = "PostgreSQL 16.10"
+				Expect(validator.ValidatePostgreSQLVersion()).To(Succeed())
+			})
 		})
 		Context("Validate roles", func() {
 			It("Fails if role missing", func() {
@@ -236,8 +275,173 @@ var _ = Describe("Validate deployment", func() {
 				err = validator.ValidateRoles()
 				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.IncorrectRolePrmissionValidationError, "pgadmin"))))
 			})
+			It("Fails if an option that used to be ignored does not match", func() {
+				validator.ManifestProps.Databases.Roles[0].Permissions = []string{
+					"nosuperuser createdb CREATEROLE",
+					"NOINHERIT REPLICATION BYPASSRLS",
+					"CONNECTION LIMIT 20 VALID UNTIL",
+					"'May 5 12:00:00 2017 +1'",
+				}
+				err := mockDate("May 5 12:00:00 2017 +1", "2017-05-05T11:00:00+00:00", mocks)
+				Expect(err).NotTo(HaveOccurred())
+				err = validator.ValidateRoles()
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.IncorrectRolePrmissionValidationError, "pgadmin"))))
+			})
+			It("Fails if a permission cannot be parsed", func() {
+				validator.ManifestProps.Databases.Roles[0].Permissions = []string{"CREATEDB", "CONECTION LIMIT 20"}
+				err := validator.ValidateRoles()
+				Expect(err).To(MatchError(`Invalid permissions for role pgadmin: unexpected CONECTION`))
+			})
+			It("Fails if VALID UNTIL cannot be converted and checks the other roles", func() {
+				validator.ManifestProps.Databases.Roles = append(validator.ManifestProps.Databases.Roles, helpers.PgRoleProperties{Name: "pgadmin2"})
+				Expect(mockDate("May 5 12:00:00 2017 +1", "", mocks)).To(Succeed())
+				report, err := validator.Report()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(report.Failures()).To(Equal([]helpers.ValidationFinding{
+					{
+						Category: helpers.CategoryRoles,
+						Severity: helpers.SeverityError,
+						Object:   "pgadmin",
+						Expected: "valid permissions",
+						Actual:   "NOSUPERUSER CREATEDB CREATEROLE NOINHERIT REPLICATION CONNECTION LIMIT 20 VALID UNTIL 'May 5 12:00:00 2017 +1'",
+						Message:  fmt.Sprintf(helpers.InvalidRoleValidUntilValidationError, "May 5 12:00:00 2017 +1", "pgadmin", genericError),
+					},
+					{Category: helpers.CategoryRoles, Severity: helpers.SeverityError, Object: "pgadmin2", Expected: "present", Actual: "missing", Message: fmt.Sprintf(helpers.MissingRoleValidationError, "pgadmin2")},
+				}))
+			})
+			It("Fails on an option ALTER ROLE does not take", func() {
+				validator.ManifestProps.Databases.Roles[0].Permissions = []string{"CREATEDB", "IN ROLE pg_monitor"}
+				err := validator.ValidateRoles()
+				Expect(err).To(MatchError(`Invalid permissions for role pgadmin: IN ROLE is not allowed in ALTER ROLE, which the release applies the permissions with`))
+			})
+		})
+		Context("Validate password storage", func() {
+			var methods map[string]string
+			BeforeEach(func() {
+				validator.PostgresData.Settings["password_encryption"] = "scram-sha-256"
+				validator.ManifestProps.Databases.Roles = append(validator.ManifestProps.Databases.Roles, helpers.PgRoleProperties{Name: "certuser"})
+				methods = map[string]string{
+					"pgadmin":  helpers.PasswordMethodSCRAM,
+					"certuser": helpers.PasswordMethodNone,
+					"md5user":  helpers.PasswordMethodMD5,
+				}
+			})
+			It("Accepts passwords stored with password_encryption", func() {
+				Expect(validator.MatchPasswordStorage(methods)).To(Succeed())
+			})
+			It("Fails if a password is still stored as md5", func() {
+				methods["pgadmin"] = helpers.PasswordMethodMD5
+				err := validator.MatchPasswordStorage(methods)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.IncorrectPasswordStorageValidationError, "pgadmin", "md5", "scram-sha-256"))))
+			})
+			It("Expects md5 when password_encryption selects it", func() {
+				validator.PostgresData.Settings["password_encryption"] = "on"
+				err := validator.MatchPasswordStorage(methods)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.IncorrectPasswordStorageValidationError, "pgadmin", "scram-sha-256", "md5"))))
+			})
+			It("Expects no password for PASSWORD NULL", func() {
+				validator.ManifestProps.Databases.Roles[0].Permissions = []string{"PASSWORD NULL"}
+				err := validator.MatchPasswordStorage(methods)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.IncorrectPasswordStorageValidationError, "pgadmin", "scram-sha-256", "no password"))))
+			})
+			It("Expects a hashed password to be stored as is", func() {
+				validator.ManifestProps.Databases.Roles[0].Password = helpers.MD5PasswordHash("pgadmin", "admin")
+				methods["pgadmin"] = helpers.PasswordMethodMD5
+				Expect(validator.MatchPasswordStorage(methods)).To(Succeed())
+			})
+			It("Fails without password_encryption", func() {
+				delete(validator.PostgresData.Settings, "password_encryption")
+				err := validator.MatchPasswordStorage(methods)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.MissingSettingValidationError, "password_encryption"))))
+			})
+		})
+		Context("Validate grants", func() {
+			var grants helpers.PGGrants
+			BeforeEach(func() {
+				grants = helpers.PGGrants{
+					Databases: []helpers.PGDatabasePrivilege{
+						{Database: "db1", Owner: "vcap", Grantee: "PUBLIC", Privilege: "CONNECT"},
+						{Database: "db1", Owner: "vcap", Grantee: "PUBLIC", Privilege: "TEMPORARY"},
+						{Database: "db1", Owner: "vcap", Grantee: "vcap", Privilege: "CONNECT"},
+					},
+					Schemas: []helpers.PGSchemaPrivilege{
+						{Database: "db1", Schema: "public", Owner: "pg_database_owner", Grantee: "PUBLIC", Privilege: "USAGE"},
+						{Database: "db1", Schema: "public", Owner: "pg_database_owner", Grantee: "pgadmin", Privilege: "CREATE"},
+						{Database: "db1", Schema: "public", Owner: "pg_database_owner", Grantee: "pgadmin", Privilege: "USAGE"},
+					},
+					Tables: []helpers.PGTablePrivilege{
+						{Database: "db1", Schema: "public", Table: "t1", Owner: "pgadmin", Grantee: "pgadmin", Privilege: "SELECT"},
+					},
+					Memberships: []helpers.PGRoleMembership{
+						{Role: "pg_monitor", Member: "vcap"},
+					},
+				}
+			})
+			It("Accepts the grants made by the release", func() {
+				Expect(validator.MatchGrants(grants)).To(Succeed())
+			})
+			It("Fails if CREATE on the public schema is only granted to PUBLIC", func() {
+				grants.Schemas[1].Grantee = "PUBLIC"
+				err := validator.MatchGrants(grants)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.MissingGrantValidationError, "pgadmin", "CREATE", "schema db1: public"))))
+			})
+			It("Fails if the role cannot connect", func() {
+				grants.Databases = grants.Databases[2:]
+				err := validator.MatchGrants(grants)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.MissingGrantValidationError, "pgadmin", "CONNECT", "database db1"))))
+			})
+			It("Fails on a table privilege the role does not own", func() {
+				grants.Tables = append(grants.Tables, helpers.PGTablePrivilege{Database: "db1", Schema: "public", Table: "t2", Owner: "vcap", Grantee: "pgadmin", Privilege: "DELETE"})
+				err := validator.MatchGrants(grants)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.ExtraGrantValidationError, "DELETE", "pgadmin", "table db1: public.t2"))))
+			})
+			It("Fails on a database privilege granted to the role", func() {
+				grants.Databases = append(grants.Databases, helpers.PGDatabasePrivilege{Database: "db1", Owner: "vcap", Grantee: "pgadmin", Privilege: "TEMPORARY"})
+				err := validator.MatchGrants(grants)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.ExtraGrantValidationError, "TEMPORARY", "pgadmin", "database db1"))))
+			})
+			It("Fails on another schema", func() {
+				grants.Schemas = append(grants.Schemas, helpers.PGSchemaPrivilege{Database: "db1", Schema: "audit", Owner: "vcap", Grantee: "pgadmin", Privilege: "USAGE"})
+				err := validator.MatchGrants(grants)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.ExtraGrantValidationError, "USAGE", "pgadmin", "schema db1: audit"))))
+			})
+			It("Fails on a membership that was not requested", func() {
+				grants.Memberships = append(grants.Memberships, helpers.PGRoleMembership{Role: "pg_monitor", Member: "pgadmin"})
+				err := validator.MatchGrants(grants)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.ExtraMembershipValidationError, "pgadmin", "pg_monitor"))))
+			})
+			It("Fails on a membership even if the permissions ask for it", func() {
+				validator.ManifestProps.Databases.Roles[0].Permissions = append(validator.ManifestProps.Databases.Roles[0].Permissions, `IN ROLE pg_monitor`)
+				grants.Memberships = append(grants.Memberships, helpers.PGRoleMembership{Role: "pg_monitor", Member: "pgadmin"})
+				err := validator.MatchGrants(grants)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.ExtraMembershipValidationError, "pgadmin", "pg_monitor"))))
+			})
 		})
 		Context("Validate settings", func() {
+			It("Compares values by meaning when pg_settings details are known", func() {
+				validator.ManifestProps.Databases.AdditionalConfig["shared_buffers"] = "128MB"
+				validator.ManifestProps.Databases.AdditionalConfig["log_checkpoints"] = true
+				validator.PostgresData.Settings["shared_buffers"] = "16384"
+				validator.PostgresData.Settings["log_checkpoints"] = "on"
+				validator.PostgresData.SettingDetails = map[string]helpers.PGSetting{
+					"shared_buffers":  {Name: "shared_buffers", Setting: "16384", Unit: "8kB", VarType: "integer"},
+					"log_checkpoints": {Name: "log_checkpoints", Setting: "on", VarType: "bool"},
+				}
+				Expect(validator.ValidateSettings()).To(Succeed())
+
+				validator.ManifestProps.Databases.AdditionalConfig["shared_buffers"] = "1GB"
+				err := validator.ValidateSettings()
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.IncorrectSettingValidationError, "1GB", "16384", "shared_buffers"))))
+			})
+			It("Fails if an additional prop value cannot be parsed", func() {
+				validator.ManifestProps.Databases.AdditionalConfig = helpers.PgAdditionalConfigMap{"shared_buffers": "lots"}
+				validator.PostgresData.Settings["shared_buffers"] = "16384"
+				validator.PostgresData.SettingDetails = map[string]helpers.PGSetting{
+					"shared_buffers": {Name: "shared_buffers", Setting: "16384", Unit: "8kB", VarType: "integer"},
+				}
+				err := validator.ValidateSettings()
+				Expect(err).To(MatchError(`Invalid value lots for setting shared_buffers: "lots" is not a number`))
+			})
 			It("Fails if additional prop value is incorrect", func() {
 				validator.ManifestProps.Databases.AdditionalConfig["max_wal_senders"] = 10
 				err := validator.ValidateSettings()
@@ -264,6 +468,122 @@ var _ = Describe("Validate deployment", func() {
 				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.IncorrectSettingValidationError, "yyy", "xxx", "log_line_prefix"))))
 			})
 		})
+		Context("Validate the settings contract", func() {
+			BeforeEach(func() {
+				validator.ManifestProps.Databases.TLS = helpers.PgTLS{Certificate: "cert", PrivateKey: "key"}
+				for key, value := range helpers.ExpectedSettings(validator.ManifestProps) {
+					validator.PostgresData.Settings[key] = fmt.Sprintf("%v", value)
+				}
+				validator.PostgresData.Settings["shared_buffers"] = "16384"
+				validator.PostgresData.Settings["authentication_timeout"] = "60"
+				validator.PostgresData.SettingDetails = map[string]helpers.PGSetting{
+					"shared_buffers":         {Name: "shared_buffers", Setting: "16384", Unit: "8kB", VarType: "integer"},
+					"authentication_timeout": {Name: "authentication_timeout", Setting: "60", Unit: "s", VarType: "integer"},
+				}
+			})
+			It("Succeeds if every setting of the template is in place", func() {
+				Expect(validator.ValidateSettingsContract()).To(Succeed())
+			})
+			It("Fails if a fixed setting is different", func() {
+				validator.PostgresData.Settings["log_directory"] = "/tmp"
+				err := validator.ValidateSettingsContract()
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.IncorrectSettingValidationError, "/var/vcap/sys/log/postgres", "/tmp", "log_directory"))))
+			})
+			It("Fails if a TLS setting is missing", func() {
+				delete(validator.PostgresData.Settings, "ssl_cert_file")
+				err := validator.ValidateSettingsContract()
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.MissingSettingValidationError, "ssl_cert_file"))))
+			})
+		})
+		Context("Validate collation versions", func() {
+			It("Fails listing the indexes to rebuild", func() {
+				drifts := []helpers.PGCollationDrift{
+					{Database: "db1", Collation: helpers.DefaultCollation, Version: "2.35", ActualVersion: "2.39", Indexes: []string{"public.users_name_idx", "public.users_email_idx"}},
+					{Database: "db1", Collation: "de_DE", Version: "2.35", ActualVersion: "2.39"},
+				}
+				err := validator.MatchCollationVersions(drifts)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.CollationVersionValidationError, "default", "db1", "2.35", "2.39", "public.users_name_idx, public.users_email_idx"))))
+
+				err = validator.MatchCollationVersions([]helpers.PGCollationDrift{
+					{Database: "db1", Collation: "de_DE", Version: "2.35", ActualVersion: "2.39", Indexes: []string{"public.users_name_de_idx"}},
+				})
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.CollationVersionValidationError, "de_DE", "db1", "2.35", "2.39", "public.users_name_de_idx"))))
+			})
+			It("Only warns about drifted collations no index uses", func() {
+				drifts := []helpers.PGCollationDrift{
+					{Database: "db1", Collation: helpers.DefaultCollation, Version: "2.35", ActualVersion: "2.39"},
+					{Database: "db1", Collation: "de_DE", Version: "2.35", ActualVersion: "2.39"},
+				}
+				Expect(validator.MatchCollationVersions(drifts[1:])).To(Succeed())
+				err := validator.MatchCollationVersions(drifts)
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.CollationVersionValidationError, "default", "db1", "2.35", "2.39", "none"))))
+			})
+			It("Succeeds without drift", func() {
+				Expect(validator.MatchCollationVersions(nil)).To(Succeed())
+			})
+		})
+		Context("Validate pending restarts", func() {
+			It("Fails if settings are waiting for a restart", func() {
+				validator.PostgresData.SettingDetails = map[string]helpers.PGSetting{
+					"shared_buffers":  {Name: "shared_buffers", Setting: "16384", Source: "configuration file", SourceFile: "/var/vcap/jobs/postgres/config/postgresql.conf", PendingRestart: true},
+					"max_connections": {Name: "max_connections", Setting: "30", Source: "configuration file", PendingRestart: true},
+					"work_mem":        {Name: "work_mem", Setting: "4096", Source: "configuration file"},
+				}
+				Expect(validator.PendingRestartSettings()).To(Equal([]string{"max_connections", "shared_buffers"}))
+				err := validator.ValidateNoPendingRestart()
+				Expect(err).To(MatchError(errors.New(fmt.Sprintf(helpers.PendingRestartValidationError, "max_connections, shared_buffers"))))
+			})
+			It("Succeeds if no setting is pending", func() {
+				Expect(validator.PendingRestartSettings()).To(BeEmpty())
+				Expect(validator.ValidateNoPendingRestart()).To(Succeed())
+			})
+		})
+	})
+	Describe("Report every finding", func() {
+		It("Collects all the failures instead of stopping at the first", func() {
+			validator.ManifestProps.Databases.Databases = append(validator.ManifestProps.Databases.Databases, helpers.PgDBProperties{Name: "zz2"})
+			validator.ManifestProps.Databases.Roles = append(validator.ManifestProps.Databases.Roles, helpers.PgRoleProperties{Name: "pgadmin2"})
+			validator.ManifestProps.Databases.Port = 1111
+			validator.PostgreSQLVersion = "PostgreSQL 16"
+			validator.PostgresData.Databases[1].DBExts[2].DefaultVersion = "1.8"
+			err := mockDate("May 5 12:00:00 2017 +1", "2017-05-05T11:00:00+00:00", mocks)
+			Expect(err).NotTo(HaveOccurred())
+
+			report, err := validator.Report()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Findings).To(Equal([]helpers.ValidationFinding{
+				{Category: helpers.CategoryDatabases, Severity: helpers.SeverityError, Object: "zz2", Expected: "present", Actual: "missing", Message: fmt.Sprintf(helpers.MissingDatabaseValidationError, "zz2")},
+				{Category: helpers.CategoryExtensions, Severity: helpers.SeverityWarning, Object: "db1: citext", Expected: "1.8", Actual: "1.6", Message: fmt.Sprintf(helpers.OutdatedExtensionValidationError, "citext", "db1", "1.6", "1.8", "citext")},
+				{Category: helpers.CategoryRoles, Severity: helpers.SeverityError, Object: "pgadmin2", Expected: "present", Actual: "missing", Message: fmt.Sprintf(helpers.MissingRoleValidationError, "pgadmin2")},
+				{Category: helpers.CategorySettings, Severity: helpers.SeverityError, Object: "port", Expected: "1111", Actual: "5522", Message: fmt.Sprintf(helpers.IncorrectSettingValidationError, 1111, 5522, "port")},
+				{Category: helpers.CategoryVersion, Severity: helpers.SeverityError, Object: "server", Expected: "PostgreSQL 16", Actual: "PostgreSQL 9.4.9", Message: fmt.Sprintf(helpers.WrongPostreSQLVersionError, "PostgreSQL 9.4.9", "PostgreSQL 16")},
+			}))
+			Expect(mockDate("May 5 12:00:00 2017 +1", "2017-05-05T11:00:00+00:00", mocks)).To(Succeed())
+			Expect(validator.ValidateAll()).To(MatchError(report))
+		})
+		It("Shows the expected and actual role attributes", func() {
+			validator.ManifestProps.Databases.Roles[0].Permissions = []string{"SUPERUSER", "CONNECTION LIMIT 20"}
+			report, err := validator.Report()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Failures()).To(Equal([]helpers.ValidationFinding{
+				{
+					Category: helpers.CategoryRoles,
+					Severity: helpers.SeverityError,
+					Object:   "pgadmin",
+					Expected: "SUPERUSER NOCREATEDB NOCREATEROLE INHERIT LOGIN NOREPLICATION NOBYPASSRLS CONNECTION LIMIT 20",
+					Actual:   "NOSUPERUSER CREATEDB CREATEROLE NOINHERIT LOGIN REPLICATION NOBYPASSRLS CONNECTION LIMIT 20 VALID UNTIL '2017-05-05T11:00:00+00:00'",
+					Message:  fmt.Sprintf(helpers.IncorrectRolePrmissionValidationError, "pgadmin"),
+				},
+			}))
+		})
+		It("Does not fail on warnings", func() {
+			validator.PostgresData.Databases[1].DBExts[2].DefaultVersion = "1.8"
+			Expect(mockDate("May 5 12:00:00 2017 +1", "2017-05-05T11:00:00+00:00", mocks)).To(Succeed())
+			report, err := validator.Report()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Warnings()).To(HaveLen(1))
+			Expect(report.Err()).To(Succeed())
+		})
 	})
 	Describe("Check consistency after an upgrade", func() {
 		Context("Validate tables", func() {
@@ -355,7 +675,78 @@ var _ = Describe("Validate deployment", func() {
 				}
 				Expect(validator.CompareTablesTo(dataAfter)).To(BeFalse())
 			})
+			It("Reports no content change if checksums match", func() {
+				validator.PostgresData.Databases[1].Tables[0].Checksum = "aaa"
+				dataAfter, err := validator.PostgresData.CopyData()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(validator.CompareTableContentsTo(dataAfter)).To(BeEmpty())
+			})
+			It("Reports the tables whose content changed", func() {
+				validator.PostgresData.Databases[1].Tables[0].Checksum = "aaa"
+				validator.PostgresData.Databases[1].Tables[1].Checksum = "bbb"
+				dataAfter, err := validator.PostgresData.CopyData()
+				Expect(err).NotTo(HaveOccurred())
+				dataAfter.Databases[1].Tables[1].Checksum = "ccc"
+				Expect(validator.CompareTablesTo(dataAfter)).To(BeTrue())
+				Expect(validator.CompareTableContentsTo(dataAfter)).To(Equal([]string{"db1: myschema2.mytable2"}))
+			})
+			It("Skips tables without checksums", func() {
+				validator.PostgresData.Databases[1].Tables[0].Checksum = "aaa"
+				dataAfter, err := validator.PostgresData.CopyData()
+				Expect(err).NotTo(HaveOccurred())
+				dataAfter.Databases[1].Tables[0].Checksum = ""
+				Expect(validator.CompareTableContentsTo(dataAfter)).To(BeEmpty())
+			})
 
 		})
+		Context("Validate preserved checksums, encodings and locales", func() {
+			BeforeEach(func() {
+				validator.PostgresData = helpers.PGOutputData{
+					Databases: []helpers.PGDatabase{
+						helpers.PGDatabase{Name: helpers.DefaultDB, Encoding: "UTF8", Collate: "en_US.UTF-8", CType: "en_US.UTF-8", LocaleProvider: "libc"},
+						helpers.PGDatabase{Name: "db1", Encoding: "UTF8", Collate: "en_US.UTF-8", CType: "en_US.UTF-8", LocaleProvider: "libc"},
+					},
+					Settings: map[string]string{
+						"data_checksums":  "off",
+						"server_encoding": "UTF8",
+					},
+				}
+			})
+			It("Succeeds if nothing changed", func() {
+				dataAfter, err := validator.PostgresData.CopyData()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(validator.ValidatePreservedIn(dataAfter)).To(Succeed())
+			})
+			It("Reports every change at once", func() {
+				dataAfter, err := validator.PostgresData.CopyData()
+				Expect(err).NotTo(HaveOccurred())
+				dataAfter.Settings["data_checksums"] = "on"
+				dataAfter.Databases[1].Collate = "C"
+				dataAfter.Databases[1].LocaleProvider = "builtin"
+				err = validator.ValidatePreservedIn(dataAfter)
+				Expect(err).To(HaveOccurred())
+				report := err.(helpers.ValidationReport)
+				var messages []string
+				for _, finding := range report.Failures() {
+					Expect(finding.Category).To(Equal(helpers.CategoryUpgrade))
+					messages = append(messages, finding.Message)
+				}
+				Expect(messages).To(Equal([]string{
+					fmt.Sprintf(helpers.ChangedPropertyValidationError, "data_checksums", "the cluster", "off", "on"),
+					fmt.Sprintf(helpers.ChangedPropertyValidationError, "datcollate", "database db1", "en_US.UTF-8", "C"),
+					fmt.Sprintf(helpers.ChangedPropertyValidationError, "locale provider", "database db1", "libc", "builtin"),
+				}))
+			})
+			It("Skips what the snapshot did not record and dropped databases", func() {
+				validator.PostgresData.Databases[0].LocaleProvider = ""
+				delete(validator.PostgresData.Settings, "server_encoding")
+				dataAfter, err := validator.PostgresData.CopyData()
+				Expect(err).NotTo(HaveOccurred())
+				dataAfter.Databases[0].LocaleProvider = "libc"
+				dataAfter.Databases = dataAfter.Databases[:1]
+				dataAfter.Settings["server_encoding"] = "SQL_ASCII"
+				Expect(validator.ValidatePreservedIn(dataAfter)).To(Succeed())
+			})
+		})
 	})
 })
@@ -3,7 +3,6 @@ package helpers
 import (
 	"io/ioutil"
 	"sort"
-	"strings"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -53,11 +52,17 @@ func (v PostgresReleaseVersions) GetPostgreSQLVersion(key int) string {
 	return v.Versions[key]
 }
 
+// IsMajor reports whether going from the PostgreSQL version of the release
+// key to current changes the major version. Versions that cannot be parsed
+// are taken as a major change.
 func (v PostgresReleaseVersions) IsMajor(current string, key int) bool {
-	value1 := strings.Split(v.Versions[key], ".")
-	value2 := strings.Split(current, ".")
-	if strings.Join(value1[:len(value1)-1], ".") == strings.Join(value2[:len(value2)-1], ".") {
-		return false
+	previous, err := ParsePGVersion(v.Versions[key])
+	if err != nil {
+		return true
+	}
+	next, err := ParsePGVersion(current)
+	if err != nil {
+		return true
 	}
-	return true
+	return !previous.SameMajor(next)
 }
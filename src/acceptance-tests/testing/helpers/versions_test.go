@@ -68,6 +68,24 @@ versions:
 			isMajor = pgVersions.IsMajor("PostgreSQL 9.4.7", 2)
 			Expect(isMajor).To(BeFalse())
 		})
+		It("Check if major upgrade across numbering schemes", func() {
+			versionsFilePath, err := writeVersionsFile(`
+versions:
+  1: "PostgreSQL 9.6.24"
+  2: "PostgreSQL 15.10"
+  3: "PostgreSQL 16.1"
+`)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.Remove, versionsFilePath)
+			pgVersions, err := helpers.NewPostgresReleaseVersions(versionsFilePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pgVersions.IsMajor("PostgreSQL 10.1", 1)).To(BeTrue())
+			Expect(pgVersions.IsMajor("PostgreSQL 16.6", 2)).To(BeTrue())
+			Expect(pgVersions.IsMajor("PostgreSQL 15.12", 2)).To(BeFalse())
+			Expect(pgVersions.IsMajor("PostgreSQL 16.10", 3)).To(BeFalse())
+			Expect(pgVersions.IsMajor("not a version", 3)).To(BeTrue())
+		})
 	})
 	Context("With an invalid config yaml location", func() {
 		It("Should return an error that the file does not exist", func() {
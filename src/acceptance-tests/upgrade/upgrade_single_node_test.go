@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	"github.com/cloudfoundry/postgres-release/src/acceptance-tests/testing/helpers"
 
@@ -27,7 +28,7 @@ var _ = Describe("Upgrading postgres-release", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
-	JustBeforeEach(func() {
+	JustBeforeEach(func(ctx SpecContext) {
 		var err error
 		deployHelper.SetDeploymentName(deploymentPrefix)
 		deployHelper.SetPGVersion(version)
@@ -48,40 +49,106 @@ var _ = Describe("Upgrading postgres-release", func() {
 		DB, err = deployHelper.ConnectToPostgres(pgHost, pgprops)
 		Expect(err).NotTo(HaveOccurred())
 		By("Populating the database")
-		err = DB.CreateAndPopulateTables(pgprops.Databases.Databases[0].Name, helpers.SmallLoad)
+		err = DB.CreateAndPopulateTablesContext(ctx, pgprops.Databases.Databases[0].Name, helpers.SmallLoad)
 		Expect(err).NotTo(HaveOccurred())
 	})
 
-	AssertUpgradeSuccessful := func() func() {
-		return func() {
+	// saveSnapshot archives data in the configured snapshots directory, named
+	// after the spec and the release version the director deployed. A
+	// snapshot left there by a previous run of the same spec and release must
+	// have the same databases and tables; other changes are only logged.
+	saveSnapshot := func(data helpers.PGOutputData) {
+		if configParams.SnapshotsDir == "" {
+			return
+		}
+		releaseVersion, err := deployHelper.GetDeployment().GetReleaseVersion("postgres")
+		Expect(err).NotTo(HaveOccurred())
+		path := filepath.Join(configParams.SnapshotsDir, fmt.Sprintf("%s-%s.yml", deploymentPrefix, releaseVersion))
+		if previous, err := helpers.LoadPGSnapshot(path); err == nil {
+			diff := helpers.DiffPGOutputData(previous.Data, data)
+			GinkgoWriter.Printf("Changes since the snapshot in %s:\n%s\n", path, diff)
+			Expect(diff.TablesChanged()).To(BeFalse(), "tables differ from the snapshot in %s:\n%s", path, diff)
+		}
+		err = helpers.NewPGSnapshot(data, releaseVersion).Save(path)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	AssertUpgradeSuccessful := func() func(SpecContext) {
+		return func(ctx SpecContext) {
 			var err error
 			By("Validating the database has been deployed as requested")
-			pgData, err := DB.GetData()
+			pgData, err := DB.GetDataWithOptionsContext(ctx, helpers.PGDataOptions{TableChecksums: true})
 			Expect(err).NotTo(HaveOccurred())
+			saveSnapshot(pgData)
 			validator := helpers.NewValidator(pgprops, pgData, DB, versions.GetPostgreSQLVersion(version))
 			err = validator.ValidateAll()
 			Expect(err).NotTo(HaveOccurred())
 
+			By("Creating a role whose password is stored as md5")
+			md5User := helpers.User{Name: "md5user", Password: "md5password"}
+			err = DB.CreateMD5RoleContext(ctx, md5User.Name, md5User.Password)
+			Expect(err).NotTo(HaveOccurred())
+
 			By("Upgrading to the new release")
 			deployHelper.SetPGVersion(helpers.DeployLatestVersion)
 			err = deployHelper.Deploy()
 			Expect(err).NotTo(HaveOccurred())
+			// The connections opened before the upgrade are gone: reopen
+			// the pools so nothing read from the old server is reused.
+			DB.CloseConnections()
 
 			By("Validating the database content is still valid after upgrade")
-			pgDataAfter, err := DB.GetData()
+			pgDataAfter, err := DB.GetDataWithOptionsContext(ctx, helpers.PGDataOptions{TableChecksums: true})
+			Expect(err).NotTo(HaveOccurred())
+
+			saveSnapshot(pgDataAfter)
+			diff := validator.DiffTo(pgDataAfter)
+			Expect(diff.TablesChanged()).To(BeFalse(), diff.String())
+			Expect(validator.CompareTableContentsTo(pgDataAfter)).To(BeEmpty(), "table contents changed during the upgrade")
+
+			By("Validating the data checksums, encodings and locales have been preserved")
+			err = validator.ValidatePreservedIn(pgDataAfter)
 			Expect(err).NotTo(HaveOccurred())
 
-			tablesEqual := validator.CompareTablesTo(pgDataAfter)
-			Expect(tablesEqual).To(BeTrue())
+			By("Verifying the integrity of the tables and indexes after upgrade")
+			var dbNames []string
+			for _, database := range pgprops.Databases.Databases {
+				dbNames = append(dbNames, database.Name)
+			}
+			integrity, err := DB.CheckIntegrityContext(ctx, dbNames...)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(integrity.Corrupted()).To(BeEmpty(), integrity.String())
 
 			By("Validating the database has been upgraded as requested")
 			validator = helpers.NewValidator(pgprops, pgDataAfter, DB, latestPostgreSQLVersion)
-			err = validator.ValidateAll()
+			report, err := validator.FullReportContext(ctx)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Err()).NotTo(HaveOccurred())
+
+			By("Validating the md5 role can still log in")
+			methods, err := DB.ListPasswordMethodsContext(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(methods).To(HaveKeyWithValue(md5User.Name, helpers.PasswordMethodMD5))
+			md5Conn, err := DB.OpenConnectionContext(ctx, helpers.DefaultDB, md5User)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = md5Conn.RunContext(ctx, "SELECT 1")
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Reporting the extensions pg_upgrade left at their old version")
+			// The release creates extensions but never updates them, so these
+			// are warnings rather than failures.
+			for _, warning := range report.Warnings() {
+				GinkgoWriter.Println(warning)
+			}
 
 			By("Validating the VM can still be restarted")
+			timesBefore, err := DB.GetServerTimesContext(ctx)
+			Expect(err).NotTo(HaveOccurred())
 			err = deployHelper.GetDeployment().Restart("postgres")
 			Expect(err).NotTo(HaveOccurred())
+			timesAfter, err := DB.GetServerTimesContext(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(timesAfter.ChangeSince(timesBefore)).To(Equal(helpers.ServerRestarted))
 
 			if deploymentPrefix == "upg-old-nocopy" {
 				By("Validating the postgres-previous is not created")
@@ -35,3 +35,10 @@ var _ = BeforeSuite(func() {
 	err = directorHelper.UploadLatestReleaseFromURL("cloudfoundry", "os-conf-release")
 	Expect(err).NotTo(HaveOccurred())
 })
+
+var _ = AfterSuite(func() {
+	report := helpers.ConnectionsReport()
+	GinkgoWriter.Println(report)
+	helpers.CloseAllConnections()
+	Expect(report.Leaked).To(BeEmpty(), report.String())
+})